@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/fragment"
+	"goflysys/pkg/marshal"
+	"goflysys/pkg/secure"
+)
+
+// record is the decoded form of one datagram, printed as a line of text or
+// of JSON.
+type record struct {
+	Time       *time.Time `json:"time,omitempty"`
+	Src        string     `json:"src,omitempty"`
+	Dst        string     `json:"dst,omitempty"`
+	Type       string     `json:"type,omitempty"`
+	Codec      string     `json:"codec,omitempty"`
+	Checksum   bool       `json:"checksum,omitempty"`
+	Sealed     bool       `json:"sealed,omitempty"`
+	Fragment   string     `json:"fragment,omitempty"`
+	ReqId      *uint32    `json:"reqId,omitempty"`
+	ClientId   string     `json:"clientId,omitempty"`
+	Ack        *uint32    `json:"ack,omitempty"`
+	Selector   *uint32    `json:"selector,omitempty"`
+	Function   string     `json:"function,omitempty"`
+	Status     *uint32    `json:"status,omitempty"`
+	StatusText string     `json:"statusText,omitempty"`
+	Payload    any        `json:"payload,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// call identifies an outstanding request so its reply, which carries only the
+// request id, can be decoded with the result type of the right operation.
+type call struct {
+	client string
+	reqId  uint32
+}
+
+// decoder turns datagrams into records. It keeps the state that spans
+// datagrams: fragments waiting for the rest of their message and the
+// selectors of requests whose replies have not been seen yet.
+type decoder struct {
+	reassembler *fragment.Reassembler
+	calls       map[call]uint32
+	keys        *secure.Keyring // opens sealed messages, nil if none
+}
+
+func newDecoder(keys *secure.Keyring) *decoder {
+	return &decoder{
+		reassembler: fragment.NewReassembler(time.Minute),
+		calls:       make(map[call]uint32),
+		keys:        keys,
+	}
+}
+
+// decode returns the records for d: one for the datagram itself, plus one for
+// the reassembled message when d completes a fragmented one.
+func (dec *decoder) decode(d datagram, src, dst string) []record {
+	rec := record{Src: src, Dst: dst}
+	if !d.time.IsZero() {
+		rec.Time = &d.time
+	}
+
+	env, body, err := marshal.Open(d.payload)
+	if err != nil {
+		rec.Error = err.Error()
+		return []record{rec}
+	}
+	rec.Type = env.Type.String()
+	rec.Checksum = env.Flags&marshal.FlagChecksum != 0
+	if env.Flags&marshal.FlagClientID != 0 {
+		rec.ClientId = api.ClientOf(env, src, nil).ID
+	}
+	if env.Flags&marshal.FlagAck != 0 {
+		rec.Ack = &env.Ack
+	}
+
+	if env.Flags&marshal.FlagFragment != 0 {
+		if len(body) >= 8 {
+			rec.Fragment = fmt.Sprintf("message %d, fragment %d of %d",
+				binary.BigEndian.Uint32(body[0:4]), binary.BigEndian.Uint16(body[4:6]), binary.BigEndian.Uint16(body[6:8]))
+		}
+		msg, err := dec.reassembler.Add(src+">"+dst, d.payload)
+		if err != nil {
+			rec.Error = err.Error()
+			return []record{rec}
+		}
+		if msg == nil {
+			return []record{rec}
+		}
+		whole := dec.decode(datagram{time: d.time, payload: msg}, src, dst)
+		return append([]record{rec}, whole...)
+	}
+
+	if env.Flags&marshal.FlagSealed != 0 {
+		rec.Sealed = true
+		if dec.keys == nil {
+			return []record{rec}
+		}
+		if body, _, err = dec.keys.Open(env, body); err != nil {
+			rec.Error = err.Error()
+			return []record{rec}
+		}
+	}
+
+	c, err := codec.ForFlags(env.Flags)
+	if err != nil {
+		rec.Error = err.Error()
+		return []record{rec}
+	}
+	rec.Codec = c.Name()
+
+	msg, err := c.Decode(env.Type, body)
+	if err != nil {
+		rec.Error = err.Error()
+		return []record{rec}
+	}
+
+	switch env.Type {
+	case marshal.MessageRequest:
+		rec.ReqId, rec.Selector = &msg.ID, &msg.Code
+		dec.calls[call{client: src, reqId: msg.ID}] = msg.Code
+		op, ok := api.Operations[msg.Code]
+		if !ok {
+			rec.Error = "unknown selector"
+			return []record{rec}
+		}
+		rec.Function = op.Name
+		rec.Payload, err = decodePayload(msg, op.NewArgs())
+	case marshal.MessageReply:
+		rec.ReqId, rec.Status = &msg.ID, &msg.Code
+		rec.StatusText = api.StatusText[msg.Code]
+		selector, ok := dec.calls[call{client: dst, reqId: msg.ID}]
+		if !ok {
+			if msg.HasPayload() {
+				rec.Error = "result of unknown request"
+			}
+			return []record{rec}
+		}
+		rec.Selector = &selector
+		op, ok := api.Operations[selector]
+		if !ok {
+			return []record{rec}
+		}
+		rec.Function = op.Name
+		if msg.HasPayload() {
+			rec.Payload, err = decodePayload(msg, op.NewResult())
+		}
+	case marshal.MessageNotification:
+		rec.Selector = &msg.Code
+		n, ok := api.Notifications[msg.Code]
+		if !ok {
+			rec.Error = "unknown selector"
+			return []record{rec}
+		}
+		rec.Function = n.Name
+		rec.Payload, err = decodePayload(msg, n.New())
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	return []record{rec}
+}
+
+func decodePayload(msg *codec.Body, v api.Message) (any, error) {
+	if err := msg.DecodePayload(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
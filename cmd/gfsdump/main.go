@@ -0,0 +1,159 @@
+// Command gfsdump decodes captured flight protocol traffic offline. It reads a
+// classic pcap file, keeping UDP datagrams to or from the service port and
+// notifications to its clients, or a hex dump with one datagram per line, and
+// prints every message with its request id, function, arguments, status and
+// result. Payloads are decoded with the operation and notification tables
+// generated from flights.idl, so gfsdump always understands the same protocol
+// as the server.
+//
+// Usage:
+//
+//	gfsdump [-port 8888] [-json] [-keys file] [file]
+//
+// Sealed messages are only decoded given the server's key file with -keys.
+// The file defaults to standard input. Hex dumps may be plain hex or Go byte
+// slices as the server logs them, so its output can be piped in directly.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"goflysys/pkg/secure"
+)
+
+func main() {
+	port := flag.Uint("port", 8888, "service UDP port to keep from pcap files, 0 for every port")
+	asJSON := flag.Bool("json", false, "print one JSON object per message")
+	keysPath := flag.String("keys", "", "client key file to open sealed messages with")
+	flag.Parse()
+
+	var keys *secure.Keyring
+	if *keysPath != "" {
+		var err error
+		if keys, err = secure.LoadKeyring(*keysPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 1 {
+		log.Fatal("gfsdump: at most one input file")
+	}
+	if flag.NArg() == 1 && flag.Arg(0) != "-" {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := bufio.NewReader(in)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	dec := newDecoder(keys)
+	emit := func(records []record) {
+		for _, rec := range records {
+			if *asJSON {
+				line, _ := json.Marshal(rec)
+				out.Write(append(line, '\n'))
+			} else {
+				fmt.Fprintln(out, rec.text())
+			}
+		}
+	}
+
+	var err error
+	if header, _ := r.Peek(4); isPcap(header) {
+		// older servers send notifications from an ephemeral port, so also
+		// keep anything sent to an address that has talked to the service port
+		clients := make(map[string]bool)
+		err = readPcap(r, func(d datagram) {
+			src := fmt.Sprintf("%s:%d", bracket(d.src), d.srcPort)
+			dst := fmt.Sprintf("%s:%d", bracket(d.dst), d.dstPort)
+			if uint(d.dstPort) == *port {
+				clients[src] = true
+			} else if *port != 0 && uint(d.srcPort) != *port && !clients[dst] {
+				return
+			}
+			emit(dec.decode(d, src, dst))
+		})
+	} else {
+		err = readHex(r, func(d datagram) {
+			emit(dec.decode(d, "", ""))
+		})
+	}
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+// bracket wraps IPv6 addresses so a port can follow them.
+func bracket(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+	return ip
+}
+
+// text formats rec as one human-readable line, e.g.
+//
+//	15:04:05.000000 10.0.0.2:50000 > 10.0.0.1:8888 request #7 GetFlightById(2) cdr {"id":1}
+func (rec record) text() string {
+	var b strings.Builder
+	if rec.Time != nil {
+		b.WriteString(rec.Time.Format("15:04:05.000000 "))
+	}
+	if rec.Src != "" {
+		fmt.Fprintf(&b, "%s > %s ", rec.Src, rec.Dst)
+	}
+	if rec.Type == "" {
+		b.WriteString("invalid")
+	} else {
+		b.WriteString(rec.Type)
+	}
+	if rec.Fragment != "" {
+		fmt.Fprintf(&b, " (%s)", rec.Fragment)
+	}
+	if rec.ReqId != nil {
+		fmt.Fprintf(&b, " #%d", *rec.ReqId)
+	}
+	if rec.ClientId != "" {
+		fmt.Fprintf(&b, " from %s", rec.ClientId)
+	}
+	if rec.Ack != nil {
+		fmt.Fprintf(&b, " ack #%d", *rec.Ack)
+	}
+	if rec.Function != "" {
+		fmt.Fprintf(&b, " %s(%d)", rec.Function, *rec.Selector)
+	} else if rec.Selector != nil {
+		fmt.Fprintf(&b, " selector %d", *rec.Selector)
+	}
+	if rec.Status != nil {
+		fmt.Fprintf(&b, " %d %s", *rec.Status, rec.StatusText)
+	}
+	if rec.Sealed {
+		b.WriteString(" sealed")
+	}
+	if rec.Codec != "" {
+		fmt.Fprintf(&b, " %s", rec.Codec)
+	}
+	if rec.Payload != nil {
+		payload, _ := json.Marshal(rec.Payload)
+		fmt.Fprintf(&b, " %s", payload)
+	}
+	if rec.Error != "" {
+		fmt.Fprintf(&b, " error: %s", rec.Error)
+	}
+
+	return strings.TrimRight(b.String(), " ")
+}
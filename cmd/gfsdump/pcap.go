@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// datagram is one UDP payload with where and when it was captured. Addresses
+// and time are empty for hex dumps.
+type datagram struct {
+	time     time.Time
+	src, dst string
+	srcPort  uint16
+	dstPort  uint16
+	payload  []byte
+}
+
+// Link-layer header types of the capture formats gfsdump understands.
+const (
+	linkNull     = 0   // BSD loopback
+	linkEthernet = 1   // Ethernet II
+	linkRaw      = 101 // raw IPv4 or IPv6
+	linkLinuxSLL = 113 // Linux cooked capture, as from tcpdump -i any
+)
+
+// maxRecord bounds the packets readPcap allocates, whatever the file's
+// snapshot length says; the server never sends a datagram near it.
+const maxRecord = 256 << 10
+
+var errNotUDP = errors.New("not a UDP packet")
+
+// isPcap reports whether header starts a classic pcap file in either byte
+// order, with microsecond or nanosecond timestamps.
+func isPcap(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1:
+		return true
+	}
+	return false
+}
+
+// readPcap calls fn with every UDP datagram in a classic pcap file. Packets
+// that are not UDP over IPv4 or IPv6 are skipped.
+func readPcap(r io.Reader, fn func(datagram)) error {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	nanos := false
+	switch binary.LittleEndian.Uint32(header[:]) {
+	case 0xa1b2c3d4:
+	case 0xa1b23c4d:
+		nanos = true
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0x4d3cb2a1:
+		order = binary.BigEndian
+		nanos = true
+	default:
+		return errors.New("not a classic pcap file")
+	}
+	link := order.Uint32(header[20:24]) & 0x0fffffff
+	// no packet is captured longer than the snapshot length, so a longer
+	// record is a corrupt file and must not size an allocation
+	snaplen := order.Uint32(header[16:20])
+	if snaplen == 0 || snaplen > maxRecord {
+		snaplen = maxRecord
+	}
+
+	for {
+		var record [16]byte
+		if _, err := io.ReadFull(r, record[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("pcap record: %w", err)
+		}
+		sec := int64(order.Uint32(record[0:4]))
+		frac := int64(order.Uint32(record[4:8]))
+		if !nanos {
+			frac *= 1000
+		}
+		length := order.Uint32(record[8:12])
+		if length > snaplen {
+			return fmt.Errorf("pcap record of %d bytes exceeds the snapshot length %d", length, snaplen)
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return fmt.Errorf("pcap packet: %w", err)
+		}
+
+		d, err := parseLink(link, packet)
+		if err != nil {
+			continue
+		}
+		d.time = time.Unix(sec, frac)
+		fn(d)
+	}
+}
+
+// parseLink strips the link-layer header and decodes the IP and UDP headers.
+func parseLink(link uint32, packet []byte) (datagram, error) {
+	var ip []byte
+	switch link {
+	case linkNull:
+		if len(packet) < 4 {
+			return datagram{}, errNotUDP
+		}
+		ip = packet[4:]
+	case linkEthernet:
+		if len(packet) < 14 {
+			return datagram{}, errNotUDP
+		}
+		etherType := binary.BigEndian.Uint16(packet[12:14])
+		ip = packet[14:]
+		for etherType == 0x8100 && len(ip) >= 4 { // 802.1Q VLAN tag
+			etherType = binary.BigEndian.Uint16(ip[2:4])
+			ip = ip[4:]
+		}
+	case linkRaw:
+		ip = packet
+	case linkLinuxSLL:
+		if len(packet) < 16 {
+			return datagram{}, errNotUDP
+		}
+		ip = packet[16:]
+	default:
+		return datagram{}, fmt.Errorf("unsupported link type %d", link)
+	}
+
+	return parseIP(ip)
+}
+
+func parseIP(ip []byte) (datagram, error) {
+	if len(ip) < 1 {
+		return datagram{}, errNotUDP
+	}
+
+	var d datagram
+	var udp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return d, errNotUDP
+		}
+		headerLen := int(ip[0]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(ip[2:4]))
+		fragmented := binary.BigEndian.Uint16(ip[6:8])&0x3fff != 0
+		if ip[9] != 17 || fragmented || headerLen < 20 || totalLen < headerLen || totalLen > len(ip) {
+			return d, errNotUDP
+		}
+		d.src = net.IP(ip[12:16]).String()
+		d.dst = net.IP(ip[16:20]).String()
+		udp = ip[headerLen:totalLen]
+	case 6:
+		// extension headers are not followed; the server sends none
+		if len(ip) < 40 || ip[6] != 17 {
+			return d, errNotUDP
+		}
+		payloadLen := int(binary.BigEndian.Uint16(ip[4:6]))
+		if 40+payloadLen > len(ip) {
+			return d, errNotUDP
+		}
+		d.src = net.IP(ip[8:24]).String()
+		d.dst = net.IP(ip[24:40]).String()
+		udp = ip[40 : 40+payloadLen]
+	default:
+		return d, errNotUDP
+	}
+
+	if len(udp) < 8 {
+		return d, errNotUDP
+	}
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLen < 8 || udpLen > len(udp) {
+		return d, errNotUDP
+	}
+	d.srcPort = binary.BigEndian.Uint16(udp[0:2])
+	d.dstPort = binary.BigEndian.Uint16(udp[2:4])
+	d.payload = udp[8:udpLen]
+
+	return d, nil
+}
+
+// readHex calls fn with one datagram per non-empty line of r. A line is either
+// hex bytes, optionally separated by spaces or colons, or a Go byte slice as
+// printed by fmt.Println, e.g. "[71 70 1 1 ...]". Log prefixes such as
+// "Intercepted payload of" or anything before ": " are ignored, and lines that
+// hold no datagram are skipped with a warning.
+func readHex(r io.Reader, fn func(datagram)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		payload, err := parseHexLine(line)
+		if err != nil {
+			log.Printf("gfsdump: skipping line %d: %v", n, err)
+			continue
+		}
+		fn(datagram{payload: payload})
+	}
+
+	return scanner.Err()
+}
+
+func parseHexLine(line string) ([]byte, error) {
+	if i := strings.LastIndex(line, "["); i >= 0 && strings.HasSuffix(line, "]") {
+		fields := strings.Fields(line[i+1 : len(line)-1])
+		payload := make([]byte, len(fields))
+		for i, field := range fields {
+			b, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid byte %q", field)
+			}
+			payload[i] = byte(b)
+		}
+		return payload, nil
+	}
+
+	if i := strings.LastIndex(line, ": "); i >= 0 {
+		line = line[i+2:]
+	}
+	line = strings.NewReplacer(" ", "", ":", "", "\t", "").Replace(line)
+	return hex.DecodeString(line)
+}
@@ -0,0 +1,55 @@
+// Command gfsidl generates Go types and route registration from a flight
+// protocol definition file, and optionally an OpenAPI document for the
+// operations exposed over HTTP. It is run through go generate in
+// internal/api.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"goflysys/pkg/idl"
+)
+
+func main() {
+	in := flag.String("in", "flights.idl", "definition file to read")
+	out := flag.String("out", "flights_gen.go", "Go file to write")
+	openapi := flag.String("openapi", "", "OpenAPI document to write, if any")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	flag.Parse()
+
+	if *pkg == "" {
+		log.Fatal("gfsidl: -package is required outside go generate")
+	}
+
+	src, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := idl.Parse(*in, string(src))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code, err := idl.Generate(file, *pkg, filepath.Base(*in))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*out, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	if *openapi != "" {
+		doc, err := idl.OpenAPI(file, "goflysys", "1.0.0")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*openapi, doc, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// endpoint is one address the server listens on.
+type endpoint struct {
+	network string // udp, udp4, udp6, tcp, tcp4 or tcp6
+	addr    string
+}
+
+// parseListen parses a comma-separated list of [network://]host:port. An
+// address without a network is served on every transport named by transport,
+// "udp", "tcp" or "both". IPv6 hosts go in brackets, e.g. udp6://[::1]:8888.
+func parseListen(list, transport string) ([]endpoint, error) {
+	var networks []string
+	switch transport {
+	case "udp", "tcp":
+		networks = []string{transport}
+	case "both":
+		networks = []string{"udp", "tcp"}
+	default:
+		return nil, fmt.Errorf("unknown transport %q, want udp, tcp or both", transport)
+	}
+
+	var endpoints []endpoint
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specNetworks := networks
+		if network, addr, ok := strings.Cut(spec, "://"); ok {
+			switch network {
+			case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+			default:
+				return nil, fmt.Errorf("listen address %s: unknown network %q", spec, network)
+			}
+			specNetworks, spec = []string{network}, addr
+		}
+		if _, _, err := net.SplitHostPort(spec); err != nil {
+			return nil, fmt.Errorf("listen address %s: %w", spec, err)
+		}
+		for _, network := range specNetworks {
+			endpoints = append(endpoints, endpoint{network: network, addr: spec})
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no listen address")
+	}
+	return endpoints, nil
+}
@@ -1,83 +1,557 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/cipher"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"goflysys/internal/api"
+	"goflysys/internal/dispatcher"
+	"goflysys/internal/gateway"
 	"goflysys/internal/server"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/fragment"
 	"goflysys/pkg/marshal"
+	"goflysys/pkg/ratelimit"
 	"goflysys/pkg/responsemanager"
+	"goflysys/pkg/secure"
 	"goflysys/pkg/shutdown"
 )
 
 func main() {
+	semantics := flag.String("semantics", "at-most-once", "invocation semantics of every operation: at-most-once or at-least-once")
+	overrides := flag.String("semantics-for", "", "per-operation semantics, e.g. ReserveFlight=at-least-once,6=at-most-once")
+	cacheKind := flag.String("cache", responsemanager.DefaultCacheConfig.Kind, "reply cache: bigcache, lru or map")
+	cacheTTL := flag.Duration("cache-ttl", responsemanager.DefaultCacheConfig.TTL, "how long replies are kept to answer duplicates")
+	cacheEntries := flag.Int("cache-max-entries", 0, "replies kept in the cache, 0 for no cap")
+	cacheBytes := flag.Int("cache-max-bytes", 0, "total size of the replies kept in the cache, 0 for no cap")
+	maxReplies := flag.Int("max-replies-per-client", responsemanager.DefaultMaxPerClient, "unacknowledged replies kept per client, 0 for no cap")
+	transport := flag.String("transport", "udp", "transports to serve requests on: udp, tcp or both")
+	listen := flag.String("listen", ":8888", "comma-separated addresses to listen on, each [network://]host:port with network udp, udp4, udp6, tcp, tcp4 or tcp6 overriding -transport")
+	workers := flag.Int("workers", runtime.NumCPU(), "requests handled in parallel; requests from one client always run in order")
+	historyPath := flag.String("history", "", "file keeping cached replies across restarts, empty to keep them in memory only")
+	keysPath := flag.String("keys", "", "file of pre-shared client keys; when set, every request must be sealed with its client's key")
+	replayWindow := flag.Duration("replay-window", secure.DefaultReplayWindow, "how old a sealed request may be, and how long its nonce is remembered")
+	rate := flag.Float64("rate", 0, "requests per second each client may send, 0 for no limit")
+	rateBurst := flag.Float64("rate-burst", 20, "requests a client may send at once before -rate applies")
+	rateCosts := flag.String("rate-cost", "", "per-operation cost in requests against -rate, e.g. ReserveFlight=5,GetFlights=0.5")
+	maxQueued := flag.Int("max-queued", 0, "requests queued for the workers before new ones are shed, 0 to shed only when a worker's queue is full")
+	httpAddr := flag.String("http", "", "address to serve the HTTP/JSON gateway on, empty for none")
+	metricsAddr := flag.String("metrics", "", "address to serve metrics on at /debug/vars, empty for none")
+	flag.BoolVar(&verbose, "verbose", false, "log the payload of every request and reply, for debugging")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long to finish the requests in progress on SIGINT or SIGTERM")
+	var faults server.FaultConfig
+	flag.Float64Var(&faults.Drop, "fault-drop", 0, "probability of dropping each UDP request and reply, for testing")
+	flag.Float64Var(&faults.Delay, "fault-delay", 0, "probability of delaying each UDP request and reply, for testing")
+	flag.DurationVar(&faults.MaxDelay, "fault-max-delay", server.DefaultMaxDelay, "longest delay injected by -fault-delay and -fault-reorder")
+	flag.Float64Var(&faults.Duplicate, "fault-dup", 0, "probability of duplicating each UDP request and reply, for testing")
+	flag.Float64Var(&faults.Reorder, "fault-reorder", 0, "probability of reordering each UDP request and reply, for testing")
+	flag.Int64Var(&faults.Seed, "fault-seed", 0, "seed choosing the injected faults, 0 for a random one")
+	flag.Parse()
+	if err := faults.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	endpoints, err := parseListen(*listen, *transport)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *httpAddr != "" && *keysPath != "" {
+		log.Fatal("the HTTP gateway cannot authenticate requests: -http and -keys cannot be used together")
+	}
+
 	//init the storage
 	db, err := api.NewDatabase(10 * time.Second)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	//build server
-	port := ":8888"
-	newServer := server.NewUDPServer(port)
-
 	//build reqsponse cache
-	responseCache := responsemanager.NewResponseManager()
+	responseCache, err := responsemanager.NewResponseManager(responsemanager.CacheConfig{
+		Kind:       *cacheKind,
+		TTL:        *cacheTTL,
+		MaxEntries: *cacheEntries,
+		MaxBytes:   *cacheBytes,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	responseCache.MaxPerClient = *maxReplies
+	if *historyPath != "" {
+		if err := responseCache.Persist(*historyPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//load the client keys of the secure channel
+	var guard *secure.Guard
+	if *keysPath != "" {
+		keys, err := secure.LoadKeyring(*keysPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		guard = secure.NewGuard(keys, *replayWindow)
+		fmt.Printf("Accepting only requests sealed with the keys of %d clients\n", keys.Len())
+	}
+
+	//build reassembler for requests split across datagrams
+	reassembler := fragment.NewReassembler(5 * time.Second)
 
 	//build router
 	router := api.NewFlightsRouter()
 
-	//add handlers
-	router.HandleFunc(uint32(1), api.GetFlightsHandler)
-	router.HandleFunc(uint32(2), api.GetFlightByIdHandler)
-	router.HandleFunc(uint32(3), api.ReserveFlightHandler)
-	router.HandleFunc(uint32(4), api.SubscribeFlightByIdHandler)
-	router.HandleFunc(uint32(5), api.GetSeatsByIdHandler)
-	router.HandleFunc(uint32(6), api.RefundSeatBySeatNumHandler)
+	//add handlers declared in flights.idl
+	api.RegisterRoutes(router)
+
+	//choose how duplicate requests are handled
+	if router.Semantics, err = api.ParseSemantics(*semantics); err != nil {
+		log.Fatal(err)
+	}
+	if router.SemanticsFor, err = api.ParseSemanticsOverrides(*overrides); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Invocation semantics: %s\n", router.Semantics)
+	for selector, s := range router.SemanticsFor {
+		fmt.Printf("Invocation semantics of %s: %s\n", api.Operations[selector].Name, s)
+	}
+
+	//build transports, one per listen address and network
+	var transports []listener
+	for _, e := range endpoints {
+		var t server.Transport
+		var addr net.Addr
+		if strings.HasPrefix(e.network, "udp") {
+			udpServer := server.NewUDPServer(e.addr)
+			udpServer.Network = e.network
+			if err := udpServer.Start(); err != nil {
+				log.Fatal(err)
+			}
+			t, addr = udpServer, udpServer.Addr()
+			if faults.Enabled() {
+				t = server.NewFaulty(udpServer, faults)
+			}
+		} else {
+			tcpServer := server.NewTCPServer(e.addr)
+			tcpServer.Network = e.network
+			if err := tcpServer.Start(); err != nil {
+				log.Fatal(err)
+			}
+			t, addr = tcpServer, tcpServer.Addr()
+		}
+		transports = append(transports, listener{fmt.Sprintf("%s %s", strings.ToUpper(e.network), addr), t})
+	}
+
+	//limit how fast each client may send requests
+	svc := &service{router: router, db: db, responseCache: responseCache, guard: guard}
+	if *rate > 0 {
+		costs, err := api.ParseCosts(*rateCosts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if svc.limiter, err = ratelimit.New(*rate, *rateBurst, costs); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Rate limiting each client to %v requests per second, bursts of %v\n", *rate, *rateBurst)
+	}
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		if metricsServer, err = serveMetrics(*metricsAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//serve the same routes as REST over HTTP
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		gw := gateway.New(router, db)
+		gw.Limiter = svc.limiter
+		gw.OnShed = func(selector uint32) { countShed(shedRateLimit, selector) }
+		ln, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpServer = newHTTPServer(gw)
+		go func() {
+			if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("HTTP gateway stopped: %v", err)
+			}
+		}()
+		fmt.Printf("HTTP gateway started on %s\n", ln.Addr())
+	}
 
-	fmt.Printf("Server started on port %s\n", port)
+	//build worker pool, keeping the requests of each client in order
+	workerPool := dispatcher.New(*workers, 64)
+	fmt.Printf("Handling requests on %d workers\n", workerPool.Workers())
 
+	//every transport feeds the same reassembler, workers and router
+	svc.reassembler, svc.workers, svc.maxQueued = reassembler, workerPool, *maxQueued
+	var receiving sync.WaitGroup
+	failed := make(chan error, len(transports))
+	for _, l := range transports {
+		receiving.Add(1)
+		go func(l listener) {
+			defer receiving.Done()
+			if err := svc.serve(l.transport); !errors.Is(err, server.ErrClosed) {
+				failed <- fmt.Errorf("%s server stopped receiving: %w", l.name, err)
+			}
+		}(l)
+		fmt.Printf("%s server started\n", l.name)
+	}
+	drained := make(chan struct{})
 	go func() {
-		for msg := range newServer.MsgChannel {
-			reqId := marshal.UnmarshalUint32(msg.Payload[:4])
-			resp := make([]byte, 0)
-
-			hashKey := responseCache.GetHashKey(reqId, msg.Sender)
-			cachedResponse, err := responseCache.GetCachedResponse(hashKey)
-			if err == nil {
-				resp = cachedResponse
-			} else {
-				path := marshal.UnmarshalUint32(msg.Payload[4:8])
-				fmt.Printf("[%s] Request #%d for function %d chosen with payload: %s\n", msg.Sender, reqId, path, msg.Payload)
-				fmt.Println("Intercepted payload of", msg.Payload)
-
-				handler, ok := router.Routes[path]
-
-				if !ok {
-					fmt.Println("function cannot be handled")
-					resp = bytes.Join([][]byte{marshal.MarshalUint32(uint32(400)), marshal.MarshalUint32(uint32(400))}, []byte{})
-				} else {
-					resp_pointer := msg.Payload[:4]
-					resp = handler(&resp_pointer, msg.Payload[8:], db, msg.Sender)
-					responseCache.SetCachedResponse(hashKey, resp)
-				}
+		receiving.Wait()
+		reassembler.Close()
+		workerPool.Close()
+		close(drained)
+	}()
+
+	err = shutdown.Gracefully(*shutdownTimeout, failed, func(ctx context.Context) error {
+		//stop receiving, then answer what was received and send its notifications
+		if httpServer != nil {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				log.Printf("HTTP gateway did not stop: %v", err)
+			}
+		}
+		for _, l := range transports {
+			if err := l.transport.Shutdown(ctx); err != nil {
+				log.Printf("%s server did not stop receiving: %v", l.name, err)
 			}
+		}
+		var err error
+		select {
+		case <-drained:
+			err = db.WaitNotifications(ctx)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			err = fmt.Errorf("requests still in progress: %w", err)
+		}
+
+		for _, l := range transports {
+			if cerr := l.transport.Close(); cerr != nil {
+				log.Printf("Cannot close %s server: %v", l.name, cerr)
+			}
+		}
+		if cerr := responseCache.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("cannot close reply history: %w", cerr)
+		}
+		//metrics stay up until everything they count has stopped
+		if metricsServer != nil {
+			if serr := metricsServer.Shutdown(ctx); serr != nil {
+				log.Printf("Metrics server did not stop: %v", serr)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Server stopped: %v", err)
+	}
+	fmt.Println("Server stopped")
+}
+
+// newHTTPServer returns a server for handler with timeouts that bound how long
+// a slow or idle client may hold a connection.
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+// verbose logs the payload of every request and reply, in the form gfsdump
+// reads back.
+var verbose bool
+
+// listener is a transport the server receives requests on.
+type listener struct {
+	name      string
+	transport server.Transport
+}
 
-			sendAddr, err := net.ResolveUDPAddr("udp", msg.Sender)
+// logDropped reports a datagram that failed validation.
+func logDropped(sender string, err error) {
+	if errors.Is(err, marshal.ErrChecksum) {
+		log.Printf("[%s] Dropping corrupted datagram (%d so far): %v", sender, marshal.ChecksumFailures(), err)
+		return
+	}
+	log.Printf("[%s] Dropping datagram: %v", sender, err)
+}
+
+// service is everything a request goes through once received.
+type service struct {
+	router        *api.FlightsRouter
+	db            *api.FlightDatabase
+	responseCache *responsemanager.ResponseManager
+	guard         *secure.Guard      // nil outside the secure channel
+	limiter       *ratelimit.Limiter // nil without rate limiting
+	reassembler   *fragment.Reassembler
+	workers       *dispatcher.Dispatcher
+	maxQueued     int // requests queued before new ones are shed, 0 for no cap
+}
+
+// serve receives requests from t and queues them for the workers until t is
+// shut down, and returns the error Receive stopped with.
+func (s *service) serve(t server.Transport) error {
+	for {
+		msg, err := t.Receive()
+		if err != nil {
+			return err
+		}
+		payload, err := s.reassembler.Add(msg.Sender, msg.Payload)
+		if err != nil {
+			logDropped(msg.Sender, err)
+			msg.Release()
+			continue
+		}
+		if payload == nil {
+			msg.Release() // the reassembler keeps a copy of the fragment
+			continue
+		}
+		if len(payload) == 0 || &payload[0] != &msg.Payload[0] {
+			msg.Release() // reassembled into a new buffer
+			msg.Payload = payload
+		}
+
+		r, ok := s.open(msg)
+		if !ok {
+			msg.Release()
+			continue
+		}
+		client := s.clientOf(msg, r)
+
+		//a client over its rate limit is told so before its request takes a
+		//place in the queues, where it would hold up the clients behind it
+		if s.overLimit(msg, r, client) {
+			fmt.Printf("[%s] Shedding request #%d: rate limit exceeded\n", client, r.body.ID)
+			s.shed(msg, r, shedRateLimit)
+			msg.Release()
+			continue
+		}
+
+		//shed requests rather than let the receive loop wait for the
+		//workers, so that one busy client cannot hold up the others; the
+		//queue is chosen by the client id only once open has verified it
+		job := func() {
+			defer msg.Release()
+
+			reqId, resp, to := s.dispatch(msg, r, client)
+			if resp != nil {
+				send(reqId, resp, to)
+			}
+		}
+		if (s.maxQueued > 0 && s.workers.Pending() >= s.maxQueued) || !s.workers.TrySubmit(client.ID, job) {
+			fmt.Printf("[%s] Shedding request #%d: too many requests queued\n", client, r.body.ID)
+			s.shed(msg, r, shedQueueFull)
+			msg.Release()
+		}
+	}
+}
+
+// request is a received request that passed validation.
+type request struct {
+	env  marshal.Envelope
+	body *codec.Body
+	aead cipher.AEAD // seals the reply, nil outside the secure channel
+}
+
+// open validates the envelope of msg and decodes its request, or logs why
+// msg is dropped.
+func (s *service) open(msg server.Message) (request, bool) {
+	env, body, err := marshal.Open(msg.Payload)
+	if err != nil {
+		logDropped(msg.Sender, err)
+		return request{}, false
+	}
+	if env.Type != marshal.MessageRequest {
+		log.Printf("[%s] Dropping unexpected %s", msg.Sender, env.Type)
+		return request{}, false
+	}
+
+	//secure channel: only authentic, fresh requests go any further
+	var aead cipher.AEAD
+	if s.guard != nil {
+		if body, aead, err = s.guard.OpenRequest(env, body); err != nil {
+			log.Printf("[%s] Dropping request: %v", msg.Sender, err)
+			return request{}, false
+		}
+	}
+
+	c, err := codec.ForFlags(env.Flags)
+	if err != nil {
+		log.Printf("[%s] Dropping request: %v", msg.Sender, err)
+		return request{}, false
+	}
+	req, err := c.Decode(marshal.MessageRequest, body)
+	if err != nil {
+		log.Printf("[%s] Dropping malformed %s request: %v", msg.Sender, c.Name(), err)
+		return request{}, false
+	}
+	return request{env: env, body: req, aead: aead}, true
+}
+
+// reply returns the reply to r, in the codec of the request and sealed like
+// it.
+func (r request) reply(status uint32, result any) ([]byte, error) {
+	replyCodec := r.body.Codec()
+	replyEnvelope := marshal.NewEnvelope(marshal.MessageReply, replyCodec.Flags()|r.env.Flags&marshal.FlagChecksum)
+	reply, err := replyCodec.Encode(marshal.MessageReply, r.body.ID, status, result)
+	if err != nil {
+		return nil, err
+	}
+	if r.aead != nil {
+		return secure.Seal(r.aead, replyEnvelope, reply), nil
+	}
+	return replyEnvelope.Seal(reply), nil
+}
+
+// clientOf returns the client that sent r as msg.
+func (s *service) clientOf(msg server.Message, r request) api.Client {
+	var via api.Sender = msg.Replier
+	if r.aead != nil {
+		via = secure.Sender{Next: msg.Replier, AEAD: r.aead}
+	}
+	return api.ClientOf(r.env, msg.Sender, via)
+}
+
+// overLimit reports whether r, received as msg, is over the rate limit of
+// client. Duplicates of a request whose reply is cached are always let
+// through to get it. The bucket is the client id only once the secure
+// channel has authenticated it, and the sender's host otherwise, since
+// anyone can claim a fresh id on every datagram.
+func (s *service) overLimit(msg server.Message, r request, client api.Client) bool {
+	if s.limiter == nil {
+		return false
+	}
+	if s.router.CachesReplies(r.body.Code) && s.responseCache.Cached(client.ID, r.body.ID) {
+		return false
+	}
+	key := ratelimit.HostKey(msg.Sender)
+	if r.aead != nil {
+		key = client.ID
+	}
+	return !s.limiter.Allow(key, r.body.Code)
+}
+
+// dispatch routes request r from client, received as msg, and returns its id
+// with the sealed reply and the waiters to send it to, or a nil reply if it
+// cannot be encoded or is a duplicate of a request still executing.
+func (s *service) dispatch(msg server.Message, r request, client api.Client) (uint32, []byte, []responsemanager.Waiter) {
+	env, req := r.env, r.body
+	reqId := req.ID
+	path := req.Code
+
+	//the client already has these replies, stop keeping them
+	if env.Flags&marshal.FlagAck != 0 {
+		if dropped := s.responseCache.Acknowledge(client.ID, env.Ack); dropped > 0 {
+			fmt.Printf("[%s] Acknowledged replies up to #%d, dropped %d\n", client, env.Ack, dropped)
+		}
+	}
+
+	//at-most-once: answer duplicates from the cache instead of re-executing,
+	//and let those of a request still executing wait for its reply
+	cacheable := s.router.CachesReplies(path)
+	if cacheable {
+		cachedResponse, first := s.responseCache.Begin(client.ID, reqId, waiterOf(msg))
+		if cachedResponse != nil {
+			fmt.Printf("[%s] Replaying cached reply to request #%d\n", client, reqId)
+			return reqId, cachedResponse, []responsemanager.Waiter{waiterOf(msg)}
+		}
+		if !first {
+			fmt.Printf("[%s] Request #%d is still executing, waiting for its reply\n", client, reqId)
+			return reqId, nil, nil
+		}
+		//a late copy of a request whose reply is gone already executed
+		if s.responseCache.Forgotten(client.ID, reqId) {
+			fmt.Printf("[%s] Refusing request #%d: its reply was acknowledged or evicted\n", client, reqId)
+			s.responseCache.Finish(client.ID, reqId, nil)
+			resp, err := r.reply(api.StatusConflict, nil)
 			if err != nil {
-				log.Println(err)
-				resp = bytes.Join([][]byte{msg.Payload[:4], marshal.MarshalUint32(400)}, []byte{})
+				log.Printf("[%s] Cannot encode reply to request #%d: %v", msg.Sender, reqId, err)
+				return reqId, nil, nil
 			}
-			fmt.Println("Sending", resp)
-			newServer.Ln.WriteToUDP(resp, sendAddr)
+			return reqId, resp, []responsemanager.Waiter{waiterOf(msg)}
 		}
-	}()
+	}
 
-	log.Fatal(newServer.Start())
+	fmt.Printf("[%s] Request #%d for function %d chosen with %s payload: %s\n", client, reqId, path, req.Codec().Name(), msg.Payload)
+	if verbose {
+		log.Printf("Intercepted payload of %v", msg.Payload)
+	}
 
-	shutdown.Gracefully()
+	status, result := api.StatusBadRequest, any(nil)
+	if handler, ok := s.router.Routes[path]; ok {
+		status, result = handler(req, s.db, client)
+	} else {
+		fmt.Println("function cannot be handled")
+	}
+
+	resp, err := r.reply(status, result)
+	if err != nil {
+		log.Printf("[%s] Cannot encode reply to request #%d: %v", msg.Sender, reqId, err)
+		if cacheable {
+			s.responseCache.Finish(client.ID, reqId, nil)
+		}
+		return reqId, nil, nil
+	}
+	if cacheable {
+		return reqId, resp, s.responseCache.Finish(client.ID, reqId, resp)
+	}
+
+	return reqId, resp, []responsemanager.Waiter{waiterOf(msg)}
+}
+
+// shed answers r, received as msg, with StatusOverloaded without handling
+// it, and counts it as shed for reason. The reply is not cached, so that a
+// retransmission is executed once it gets through.
+func (s *service) shed(msg server.Message, r request, reason string) {
+	countShed(reason, r.body.Code)
+	resp, err := r.reply(api.StatusOverloaded, nil)
+	if err != nil {
+		log.Printf("[%s] Cannot encode reply to request #%d: %v", msg.Sender, r.body.ID, err)
+		return
+	}
+	send(r.body.ID, resp, []responsemanager.Waiter{waiterOf(msg)})
+}
+
+// waiterOf returns where the reply to msg must be sent.
+func waiterOf(msg server.Message) responsemanager.Waiter {
+	return responsemanager.Waiter{Addr: msg.Sender, Replier: msg.Replier}
+}
+
+// send sends resp, the reply to request reqId, to every waiter in to through
+// the transport its copy of the request arrived on, split into fragments if
+// that transport needs it.
+func send(reqId uint32, resp []byte, to []responsemanager.Waiter) {
+	if verbose {
+		log.Printf("Sending %v", resp)
+	}
+	for _, w := range to {
+		messages := [][]byte{resp}
+		if max := w.Replier.MaxMessage(); max > 0 {
+			var err error
+			messages, err = fragment.Split(resp, reqId, max)
+			if err != nil {
+				log.Printf("[%s] Cannot send reply to request #%d: %v", w.Addr, reqId, err)
+				continue
+			}
+		}
+		for _, message := range messages {
+			if err := w.Replier.Send(w.Addr, message); err != nil {
+				log.Printf("[%s] Cannot send reply to request #%d: %v", w.Addr, reqId, err)
+				break
+			}
+		}
+	}
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"goflysys/internal/api"
+	"goflysys/pkg/marshal"
+)
+
+// Reasons a request is shed.
+const (
+	shedRateLimit = "rate_limit" // its client is over its rate limit
+	shedQueueFull = "queue_full" // the workers have too many requests queued
+)
+
+var (
+	shedRequests            = expvar.NewMap("shed_requests")
+	shedRequestsByOperation = expvar.NewMap("shed_requests_by_operation")
+)
+
+func init() {
+	expvar.Publish("checksum_failures", expvar.Func(func() any { return marshal.ChecksumFailures() }))
+}
+
+// countShed counts a request for selector shed for reason.
+func countShed(reason string, selector uint32) {
+	shedRequests.Add(reason, 1)
+	name := "unknown"
+	if op, ok := api.Operations[selector]; ok {
+		name = op.Name
+	}
+	shedRequestsByOperation.Add(name, 1)
+}
+
+// serveMetrics serves the counters above, along with the runtime's, as JSON
+// at /debug/vars on addr, until the returned server is shut down.
+func serveMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve metrics: %w", err)
+	}
+	srv := newHTTPServer(http.DefaultServeMux)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on %s/debug/vars", ln.Addr())
+	return srv, nil
+}
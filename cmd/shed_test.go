@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/internal/dispatcher"
+	"goflysys/internal/server"
+	"goflysys/pkg/ratelimit"
+)
+
+// receiveWithin returns the next message c receives, or fails t after d.
+func receiveWithin(t *testing.T, c *server.LoopbackClient, d time.Duration) []byte {
+	t.Helper()
+	got := make(chan []byte, 1)
+	go func() {
+		reply, _ := c.Receive()
+		got <- reply
+	}()
+	select {
+	case reply := <-got:
+		return reply
+	case <-time.After(d):
+		t.Fatal("no reply")
+		return nil
+	}
+}
+
+// TestRateLimitBeforeQueue checks that the requests of a client over its
+// rate limit are shed without taking a place in the worker queues.
+func TestRateLimitBeforeQueue(t *testing.T) {
+	svc := newTestService(t)
+	svc.workers.Close()
+	svc.workers = dispatcher.New(1, 1)
+	limiter, err := ratelimit.New(0.001, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.limiter = limiter
+
+	// hold the only worker so that nothing leaves its queue
+	release, started := make(chan struct{}), make(chan struct{})
+	svc.workers.Submit("", func() { close(started); <-release })
+	<-started
+
+	loopback := server.NewLoopback()
+	serveOn(t, svc, loopback)
+	flooder, err := loopback.Dial("flooder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := loopback.Dial("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first request takes the one place in the queue, the rest are over
+	// the limit and answered at once, while the worker is still busy
+	for reqId := uint32(1); reqId <= 5; reqId++ {
+		if err := flooder.Send(encodeRequest(1, reqId, api.SelectorGetFlightById, &api.GetFlightByIdArgs{Id: 1})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		reqId, status, err := decodeReply(receiveWithin(t, flooder, time.Second), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != api.StatusOverloaded || reqId == 1 {
+			t.Errorf("request #%d: status %d, want it shed with %d", reqId, status, api.StatusOverloaded)
+		}
+	}
+	close(release)
+
+	if _, status, err := decodeReply(receiveWithin(t, flooder, time.Second), nil); err != nil || status != api.StatusOK {
+		t.Errorf("queued request: status %d, %v", status, err)
+	}
+	if err := other.Send(encodeRequest(2, 1, api.SelectorGetFlightById, &api.GetFlightByIdArgs{Id: 1})); err != nil {
+		t.Fatal(err)
+	}
+	if _, status, err := decodeReply(receiveWithin(t, other, time.Second), nil); err != nil || status != api.StatusOK {
+		t.Errorf("request of another client: status %d, %v", status, err)
+	}
+}
+
+// TestRateLimitIgnoresClaimedIds checks that a sender cannot escape its rate
+// limit by claiming a new client id on every request.
+func TestRateLimitIgnoresClaimedIds(t *testing.T) {
+	svc := newTestService(t)
+	limiter, err := ratelimit.New(0.001, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.limiter = limiter
+
+	loopback := server.NewLoopback()
+	serveOn(t, svc, loopback)
+	flooder, err := loopback.Dial("flooder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id := uint64(1); id <= 3; id++ {
+		if err := flooder.Send(encodeRequest(id, 1, api.SelectorGetFlightById, &api.GetFlightByIdArgs{Id: 1})); err != nil {
+			t.Fatal(err)
+		}
+		_, status, err := decodeReply(receiveWithin(t, flooder, time.Second), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := api.StatusOverloaded
+		if id == 1 {
+			want = api.StatusOK
+		}
+		if status != want {
+			t.Errorf("request as client %d: status %d, want %d", id, status, want)
+		}
+	}
+}
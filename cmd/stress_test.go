@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/internal/dispatcher"
+	"goflysys/internal/server"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/fragment"
+	"goflysys/pkg/marshal"
+	"goflysys/pkg/responsemanager"
+)
+
+// newTestService returns the service main builds with default settings,
+// without any transport.
+func newTestService(t *testing.T) *service {
+	t.Helper()
+	db, err := api.NewDatabase(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseCache, err := responsemanager.NewResponseManager(responsemanager.DefaultCacheConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := api.NewFlightsRouter()
+	api.RegisterRoutes(router)
+
+	svc := &service{
+		router:        router,
+		db:            db,
+		responseCache: responseCache,
+		reassembler:   fragment.NewReassembler(5 * time.Second),
+		workers:       dispatcher.New(4, 64),
+	}
+	t.Cleanup(func() {
+		svc.workers.Close()
+		svc.reassembler.Close()
+		db.WaitNotifications(context.Background())
+		responseCache.Close()
+	})
+	return svc
+}
+
+// serveOn serves svc on t until the test ends.
+func serveOn(t *testing.T, svc *service, tr server.Transport) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.serve(tr)
+	}()
+	t.Cleanup(func() {
+		tr.Shutdown(context.Background())
+		<-done
+		tr.Close()
+	})
+}
+
+// startUDP serves svc on a UDP socket on 127.0.0.1 and returns its address.
+func startUDP(t *testing.T, svc *service) *net.UDPAddr {
+	t.Helper()
+	udpServer := server.NewUDPServer("127.0.0.1:0")
+	if err := udpServer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	serveOn(t, svc, udpServer)
+	return udpServer.Addr().(*net.UDPAddr)
+}
+
+// encodeRequest returns a checksummed CDR request from the client with id.
+func encodeRequest(id uint64, reqId, selector uint32, args any) []byte {
+	body, err := codec.CDR.Encode(marshal.MessageRequest, reqId, selector, args)
+	if err != nil {
+		panic(err)
+	}
+	return marshal.NewEnvelope(marshal.MessageRequest, marshal.FlagChecksum).WithClientID(id).Seal(body)
+}
+
+// decodeReply decodes reply into result, unless result is nil, and returns
+// its request id and status.
+func decodeReply(reply []byte, result any) (uint32, uint32, error) {
+	env, body, err := marshal.Open(reply)
+	if err != nil {
+		return 0, 0, err
+	}
+	if env.Type != marshal.MessageReply {
+		return 0, 0, fmt.Errorf("got a %s instead of a reply", env.Type)
+	}
+	c, err := codec.ForFlags(env.Flags)
+	if err != nil {
+		return 0, 0, err
+	}
+	msg, err := c.Decode(marshal.MessageReply, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	if result != nil && msg.HasPayload() {
+		if err := msg.DecodePayload(result); err != nil {
+			return 0, 0, err
+		}
+	}
+	return msg.ID, msg.Code, nil
+}
+
+// call sends req from a fresh socket and returns the reply, sending it again
+// until one comes back.
+func call(addr *net.UDPAddr, req []byte) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65536)
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err == nil {
+			return buf[:n], nil
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("no reply after 5 attempts")
+}
+
+// flightDetails returns the departure time and price of every flight, which
+// never change, keyed by id.
+func flightDetails(t *testing.T, svc *service) map[uint32]api.GetFlightByIdResult {
+	t.Helper()
+	flights := make(map[uint32]api.GetFlightByIdResult)
+	for id := uint32(1); ; id++ {
+		status, result := api.GetFlightByIdHandler(&api.GetFlightByIdArgs{Id: id}, svc.db, api.Client{})
+		if status != api.StatusOK {
+			break
+		}
+		flights[id] = *result
+	}
+	if len(flights) == 0 {
+		t.Fatal("the database has no flights")
+	}
+	return flights
+}
+
+// runClients runs check for n concurrent clients and reports every failure.
+func runClients(t *testing.T, n int, check func() error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- check()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// clientConn is a client socket on one of the transports the server runs on.
+type clientConn interface {
+	Send(req []byte) error
+	// ReceiveWithin returns the next reply, or os.ErrDeadlineExceeded if none
+	// arrives within d.
+	ReceiveWithin(d time.Duration) ([]byte, error)
+	Close() error
+}
+
+type udpConn struct {
+	conn *net.UDPConn
+	buf  []byte
+}
+
+func (c *udpConn) Send(req []byte) error {
+	_, err := c.conn.Write(req)
+	return err
+}
+
+func (c *udpConn) ReceiveWithin(d time.Duration) ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(d))
+	n, err := c.conn.Read(c.buf)
+	return c.buf[:n], err
+}
+
+func (c *udpConn) Close() error { return c.conn.Close() }
+
+type loopbackConn struct {
+	*server.LoopbackClient
+	replies chan []byte
+}
+
+func dialLoopback(l *server.Loopback, name string) (*loopbackConn, error) {
+	c, err := l.Dial(name)
+	if err != nil {
+		return nil, err
+	}
+	conn := &loopbackConn{LoopbackClient: c, replies: make(chan []byte, 64)}
+	go func() {
+		defer close(conn.replies)
+		for {
+			reply, err := c.Receive()
+			if err != nil {
+				return
+			}
+			conn.replies <- reply
+		}
+	}()
+	return conn, nil
+}
+
+func (c *loopbackConn) ReceiveWithin(d time.Duration) ([]byte, error) {
+	select {
+	case reply, ok := <-c.replies:
+		if !ok {
+			return nil, server.ErrClosed
+		}
+		return reply, nil
+	case <-time.After(d):
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+// dialers returns a function per transport that serves svc on it and
+// connects clients to it.
+func dialers(t *testing.T, svc *service) map[string]func() (clientConn, error) {
+	addr := startUDP(t, svc)
+	loopback := server.NewLoopback()
+	serveOn(t, svc, loopback)
+
+	var clients atomic.Int32
+	return map[string]func() (clientConn, error){
+		"udp": func() (clientConn, error) {
+			conn, err := net.DialUDP("udp", nil, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &udpConn{conn: conn, buf: make([]byte, 65536)}, nil
+		},
+		"loopback": func() (clientConn, error) {
+			return dialLoopback(loopback, fmt.Sprint("client-", clients.Add(1)))
+		},
+	}
+}
+
+// TestInterleavedRequests has clients send bursts of GetFlightById requests
+// for different flights without waiting, over every transport, and checks
+// that every reply carries the id of an outstanding request and the details
+// of the flight it asked for. Run it with -race to catch requests sharing
+// buffers.
+func TestInterleavedRequests(t *testing.T) {
+	svc := newTestService(t)
+	flights := flightDetails(t, svc)
+	ids := make([]uint32, 0, len(flights))
+	for id := range flights {
+		ids = append(ids, id)
+	}
+
+	for transport, dial := range dialers(t, svc) {
+		dial := dial
+		t.Run(transport, func(t *testing.T) {
+			const clients, burst = 8, 32
+			runClients(t, clients, func() error {
+				id := rand.Uint64()
+				conn, err := dial()
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				return interleave(conn, id, burst, ids, flights)
+			})
+		})
+	}
+}
+
+// interleave sends burst requests from the client with id over conn without
+// waiting for replies, sending the unanswered and shed ones again, and checks
+// the replies against flights.
+func interleave(conn clientConn, id uint64, burst uint32, ids []uint32, flights map[uint32]api.GetFlightByIdResult) error {
+	requests := make(map[uint32]uint32, burst) // request id to flight
+	outstanding := make(map[uint32]uint32, burst)
+	for reqId := uint32(1); reqId <= burst; reqId++ {
+		requests[reqId] = ids[rand.Intn(len(ids))]
+		outstanding[reqId] = requests[reqId]
+	}
+
+	for attempt := 0; attempt < 5 && len(outstanding) > 0; attempt++ {
+		for reqId, flight := range outstanding {
+			if err := conn.Send(encodeRequest(id, reqId, api.SelectorGetFlightById, &api.GetFlightByIdArgs{Id: flight})); err != nil {
+				return err
+			}
+		}
+		deadline := time.Now().Add(time.Second << attempt)
+		for len(outstanding) > 0 {
+			reply, err := conn.ReceiveWithin(time.Until(deadline))
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			var result api.GetFlightByIdResult
+			reqId, status, err := decodeReply(reply, &result)
+			if err != nil {
+				return err
+			}
+			flight, ok := requests[reqId]
+			if !ok {
+				return fmt.Errorf("client %016x: reply to request #%d, never sent", id, reqId)
+			}
+			if status == api.StatusOverloaded {
+				continue // shed while the queues were full; sent again below
+			}
+			if status != api.StatusOK {
+				return fmt.Errorf("client %016x: request #%d for flight %d: status %d", id, reqId, flight, status)
+			}
+			if want := flights[flight]; result.DepartureTime != want.DepartureTime || result.Price != want.Price {
+				return fmt.Errorf("client %016x: request #%d for flight %d got the details of another flight", id, reqId, flight)
+			}
+			delete(outstanding, reqId)
+		}
+	}
+	if len(outstanding) > 0 {
+		return fmt.Errorf("client %016x: %d of %d requests unanswered", id, len(outstanding), burst)
+	}
+	return nil
+}
+
+// TestConcurrentDuplicates has clients send the same ReserveFlight from
+// several sockets at once, and checks that it executes once: every copy gets
+// the same reply, and the client holds exactly the seats it granted.
+func TestConcurrentDuplicates(t *testing.T) {
+	svc := newTestService(t)
+	addr := startUDP(t, svc)
+
+	const clients, copies = 16, 8
+	runClients(t, clients, func() error {
+		id := rand.Uint64()
+		reserve := encodeRequest(id, 1, api.SelectorReserveFlight, &api.ReserveFlightArgs{Id: 1, NumSeats: 1})
+
+		replies := make([][]byte, copies)
+		errs := make([]error, copies)
+		var wg sync.WaitGroup
+		for i := range replies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				replies[i], errs[i] = call(addr, reserve)
+			}(i)
+		}
+		wg.Wait()
+		for i := range replies {
+			if errs[i] != nil {
+				return fmt.Errorf("client %016x: copy %d: %w", id, i, errs[i])
+			}
+			if !bytes.Equal(replies[i], replies[0]) {
+				return fmt.Errorf("client %016x: copies got different replies", id)
+			}
+		}
+		var reserved api.ReserveFlightResult
+		if _, status, err := decodeReply(replies[0], &reserved); err != nil || status != api.StatusCreated {
+			return fmt.Errorf("client %016x: reservation failed: status %d, %v", id, status, err)
+		}
+
+		reply, err := call(addr, encodeRequest(id, 2, api.SelectorGetSeatsById, &api.GetSeatsByIdArgs{Id: 1}))
+		if err != nil {
+			return err
+		}
+		var held api.GetSeatsByIdResult
+		if _, _, err := decodeReply(reply, &held); err != nil {
+			return err
+		}
+		if len(held.SeatsReserved) != 1 || held.SeatsReserved[0] != reserved.SeatsReserved[0] {
+			return fmt.Errorf("client %016x: holds seats %v after reserving %v once", id, held.SeatsReserved, reserved.SeatsReserved)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/internal/server"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/marshal"
+	"goflysys/pkg/responsemanager"
+)
+
+// TestWaitersOnSeveralTransports checks that when copies of a request arrive
+// on different transports while it executes, each gets the reply through the
+// transport it came on.
+func TestWaitersOnSeveralTransports(t *testing.T) {
+	svc := newTestService(t)
+
+	udpServer := server.NewUDPServer("127.0.0.1:0")
+	if err := udpServer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer udpServer.Close()
+	conn, err := net.DialUDP("udp", nil, udpServer.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	loopback := server.NewLoopback()
+	defer loopback.Close()
+	lbClient, err := loopback.Dial("loopback-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const id, reqId = 0x1234, 1
+	client := fmt.Sprintf("client-%016x", id)
+	req := encodeRequest(id, reqId, api.SelectorReserveFlight, &api.ReserveFlightArgs{Id: 1, NumSeats: 1})
+
+	// the copy from UDP is executing when the one from the loopback arrives
+	udpWaiter := responsemanager.Waiter{Addr: conn.LocalAddr().String(), Replier: udpServer}
+	if _, first := svc.responseCache.Begin(client, reqId, udpWaiter); !first {
+		t.Fatal("Begin: request already claimed")
+	}
+	msg := server.Message{Sender: lbClient.Name, Payload: req, Replier: loopback}
+	r, ok := svc.open(msg)
+	if !ok {
+		t.Fatal("request dropped")
+	}
+	if _, resp, _ := svc.dispatch(msg, r, svc.clientOf(msg, r)); resp != nil {
+		t.Fatal("duplicate of an executing request was answered at once")
+	}
+
+	reply := []byte("reply")
+	to := svc.responseCache.Finish(client, reqId, reply)
+	if len(to) != 2 {
+		t.Fatalf("Finish returned %d waiters, want 2", len(to))
+	}
+	send(reqId, reply, to)
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], reply) {
+		t.Errorf("UDP copy got %q, %v; want %q", buf[:n], err, reply)
+	}
+	if got, err := lbClient.Receive(); err != nil || !bytes.Equal(got, reply) {
+		t.Errorf("loopback copy got %q, %v; want %q", got, err, reply)
+	}
+}
+
+// TestLateDuplicateAfterAck checks that a copy of a reservation arriving
+// after the client acknowledged its reply is refused rather than executed
+// again.
+func TestLateDuplicateAfterAck(t *testing.T) {
+	svc := newTestService(t)
+	loopback := server.NewLoopback()
+	serveOn(t, svc, loopback)
+	c, err := loopback.Dial("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const id = 0x5678
+	reserve := encodeRequest(id, 1, api.SelectorReserveFlight, &api.ReserveFlightArgs{Id: 1, NumSeats: 1})
+	body, err := codec.CDR.Encode(marshal.MessageRequest, 2, api.SelectorGetSeatsById, &api.GetSeatsByIdArgs{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seatsAck := marshal.NewEnvelope(marshal.MessageRequest, marshal.FlagChecksum).WithClientID(id).WithAck(1).Seal(body)
+
+	for i, step := range []struct {
+		req  []byte
+		want uint32
+	}{
+		{reserve, api.StatusCreated},
+		{seatsAck, api.StatusOK},
+		{reserve, api.StatusConflict}, // the late copy
+	} {
+		if err := c.Send(step.req); err != nil {
+			t.Fatal(err)
+		}
+		if _, status, err := decodeReply(receiveWithin(t, c, time.Second), nil); err != nil || status != step.want {
+			t.Fatalf("step %d: status %d, %v; want %d", i, status, err, step.want)
+		}
+	}
+
+	client := api.Client{ID: fmt.Sprintf("client-%016x", id)}
+	if _, held := api.GetSeatsByIdHandler(&api.GetSeatsByIdArgs{Id: 1}, svc.db, client); len(held.SeatsReserved) != 1 {
+		t.Errorf("client holds seats %v after one reservation", held.SeatsReserved)
+	}
+}
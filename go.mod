@@ -3,9 +3,14 @@ module goflysys
 go 1.20
 
 require (
-	github.com/allegro/bigcache/v3 v3.1.0 // indirect
-	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/allegro/bigcache/v3 v3.1.0
+	github.com/cespare/xxhash/v2 v2.2.0
+	github.com/hashicorp/go-memdb v1.3.4
+	github.com/hashicorp/golang-lru v0.5.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
 	github.com/hashicorp/go-immutable-radix v1.3.0 // indirect
-	github.com/hashicorp/go-memdb v1.3.4 // indirect
-	github.com/hashicorp/golang-lru v0.5.4 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+
+	"goflysys/pkg/marshal"
+)
+
+// Client identifies who sent a request. ID is what the server keys duplicate
+// filtering, seat ownership and subscriptions on; Addr is only where replies
+// and notifications are sent, and Via the transport they are sent on.
+type Client struct {
+	ID   string
+	Addr string
+	Via  Sender
+}
+
+// Sender sends a message to a peer of the transport a request arrived on.
+// server.Transport implements it.
+type Sender interface {
+	Send(addr string, data []byte) error
+}
+
+// ClientOf returns the client that sent a request with envelope env from addr
+// over via.
+// Clients that put an id in the envelope keep their identity when their
+// address changes, for example after rebinding the socket or behind NAT;
+// older clients are identified by their address.
+func ClientOf(env marshal.Envelope, addr string, via Sender) Client {
+	if env.Flags&marshal.FlagClientID != 0 {
+		return Client{ID: fmt.Sprintf("client-%016x", env.ClientID), Addr: addr, Via: via}
+	}
+	return Client{ID: addr, Addr: addr, Via: via}
+}
+
+func (c Client) String() string {
+	if c.ID == c.Addr {
+		return c.Addr
+	}
+	return c.ID + "@" + c.Addr
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseCosts parses a comma-separated list of operation=cost pairs such as
+// "ReserveFlight=5,1=0.5", the rate limit tokens each operation takes, where
+// the operation is given by name or selector.
+func ParseCosts(text string) (map[uint32]float64, error) {
+	costs := make(map[uint32]float64)
+	if text == "" {
+		return costs, nil
+	}
+
+	for _, pair := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cost %q, want operation=cost", pair)
+		}
+		selector, err := lookupSelector(name)
+		if err != nil {
+			return nil, err
+		}
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cost of %s: %w", name, err)
+		}
+		costs[selector] = cost
+	}
+
+	return costs, nil
+}
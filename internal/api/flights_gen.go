@@ -0,0 +1,453 @@
+// Code generated by gfsidl from flights.idl. DO NOT EDIT.
+
+package api
+
+import (
+	"goflysys/pkg/codec"
+	"goflysys/pkg/marshal"
+)
+
+// Status codes sent after the request id of every reply.
+const (
+	StatusOK           uint32 = 200
+	StatusCreated      uint32 = 201
+	StatusBadRequest   uint32 = 400
+	StatusUnauthorized uint32 = 401
+	StatusNotFound     uint32 = 404
+	StatusConflict     uint32 = 409
+	StatusOverloaded   uint32 = 503
+)
+
+// Function selectors of every operation and notification.
+const (
+	SelectorGetFlights          uint32 = 1
+	SelectorGetFlightById       uint32 = 2
+	SelectorReserveFlight       uint32 = 3
+	SelectorSubscribeFlightById uint32 = 4
+	SelectorGetSeatsById        uint32 = 5
+	SelectorRefundSeatBySeatNum uint32 = 6
+	SelectorSeatAvailability    uint32 = 8888
+)
+
+// StatusText maps each status code to its name in flights.idl.
+var StatusText = map[uint32]string{
+	StatusOK:           "OK",
+	StatusCreated:      "Created",
+	StatusBadRequest:   "BadRequest",
+	StatusUnauthorized: "Unauthorized",
+	StatusNotFound:     "NotFound",
+	StatusConflict:     "Conflict",
+	StatusOverloaded:   "Overloaded",
+}
+
+// GetFlightsArgs holds the arguments of GetFlights.
+type GetFlightsArgs struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+func (m *GetFlightsArgs) Encode(e *marshal.Encoder) {
+	e.WriteString(m.Source)
+	e.WriteString(m.Destination)
+}
+
+func (m *GetFlightsArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Source, err = d.ReadString(); err != nil {
+		return err
+	}
+	if m.Destination, err = d.ReadString(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetFlightsResult holds the result of GetFlights.
+type GetFlightsResult struct {
+	FlightIds []uint32 `json:"flightIds"`
+}
+
+func (m *GetFlightsResult) Encode(e *marshal.Encoder) {
+	e.WriteUint32Array(m.FlightIds)
+}
+
+func (m *GetFlightsResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.FlightIds, err = d.ReadUint32Array(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleGetFlights(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args GetFlightsArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), nil
+	}
+
+	status, result := GetFlightsHandler(&args, fdb, client)
+	if result == nil {
+		return status, nil
+	}
+	return status, result
+}
+
+// GetFlightByIdArgs holds the arguments of GetFlightById.
+type GetFlightByIdArgs struct {
+	Id uint32 `json:"id"`
+}
+
+func (m *GetFlightByIdArgs) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+}
+
+func (m *GetFlightByIdArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetFlightByIdResult holds the result of GetFlightById.
+type GetFlightByIdResult struct {
+	DepartureTime int64   `json:"departureTime"`
+	Price         float64 `json:"price"`
+	SeatsLeft     uint32  `json:"seatsLeft"`
+}
+
+func (m *GetFlightByIdResult) Encode(e *marshal.Encoder) {
+	e.WriteInt64(m.DepartureTime)
+	e.WriteFloat64(m.Price)
+	e.WriteUint32(m.SeatsLeft)
+}
+
+func (m *GetFlightByIdResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.DepartureTime, err = d.ReadInt64(); err != nil {
+		return err
+	}
+	if m.Price, err = d.ReadFloat64(); err != nil {
+		return err
+	}
+	if m.SeatsLeft, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleGetFlightById(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args GetFlightByIdArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), nil
+	}
+
+	status, result := GetFlightByIdHandler(&args, fdb, client)
+	if result == nil {
+		return status, nil
+	}
+	return status, result
+}
+
+// ReserveFlightArgs holds the arguments of ReserveFlight.
+type ReserveFlightArgs struct {
+	Id       uint32 `json:"id"`
+	NumSeats uint32 `json:"numSeats"`
+}
+
+func (m *ReserveFlightArgs) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+	e.WriteUint32(m.NumSeats)
+}
+
+func (m *ReserveFlightArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	if m.NumSeats, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReserveFlightResult holds the result of ReserveFlight.
+type ReserveFlightResult struct {
+	SeatsReserved []uint32 `json:"seatsReserved"`
+}
+
+func (m *ReserveFlightResult) Encode(e *marshal.Encoder) {
+	e.WriteUint32Array(m.SeatsReserved)
+}
+
+func (m *ReserveFlightResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.SeatsReserved, err = d.ReadUint32Array(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleReserveFlight(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args ReserveFlightArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), nil
+	}
+
+	status, result := ReserveFlightHandler(&args, fdb, client)
+	if result == nil {
+		return status, nil
+	}
+	return status, result
+}
+
+// SubscribeFlightByIdArgs holds the arguments of SubscribeFlightById.
+type SubscribeFlightByIdArgs struct {
+	Id      uint32 `json:"id"`
+	EndTime int64  `json:"endTime"`
+}
+
+func (m *SubscribeFlightByIdArgs) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+	e.WriteInt64(m.EndTime)
+}
+
+func (m *SubscribeFlightByIdArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	if m.EndTime, err = d.ReadInt64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubscribeFlightByIdResult holds the result of SubscribeFlightById.
+type SubscribeFlightByIdResult struct {
+	Subscribed bool `json:"subscribed"`
+}
+
+func (m *SubscribeFlightByIdResult) Encode(e *marshal.Encoder) {
+	e.WriteBool(m.Subscribed)
+}
+
+func (m *SubscribeFlightByIdResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Subscribed, err = d.ReadBool(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleSubscribeFlightById(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args SubscribeFlightByIdArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), &SubscribeFlightByIdResult{}
+	}
+
+	status, result := SubscribeFlightByIdHandler(&args, fdb, client)
+	if result == nil {
+		return status, &SubscribeFlightByIdResult{}
+	}
+	return status, result
+}
+
+// GetSeatsByIdArgs holds the arguments of GetSeatsById.
+type GetSeatsByIdArgs struct {
+	Id uint32 `json:"id"`
+}
+
+func (m *GetSeatsByIdArgs) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+}
+
+func (m *GetSeatsByIdArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSeatsByIdResult holds the result of GetSeatsById.
+type GetSeatsByIdResult struct {
+	SeatsReserved []uint32 `json:"seatsReserved"`
+}
+
+func (m *GetSeatsByIdResult) Encode(e *marshal.Encoder) {
+	e.WriteUint32Array(m.SeatsReserved)
+}
+
+func (m *GetSeatsByIdResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.SeatsReserved, err = d.ReadUint32Array(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleGetSeatsById(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args GetSeatsByIdArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), nil
+	}
+
+	status, result := GetSeatsByIdHandler(&args, fdb, client)
+	if result == nil {
+		return status, nil
+	}
+	return status, result
+}
+
+// RefundSeatBySeatNumArgs holds the arguments of RefundSeatBySeatNum.
+type RefundSeatBySeatNumArgs struct {
+	Id      uint32 `json:"id"`
+	SeatNum uint32 `json:"seatNum"`
+}
+
+func (m *RefundSeatBySeatNumArgs) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+	e.WriteUint32(m.SeatNum)
+}
+
+func (m *RefundSeatBySeatNumArgs) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	if m.SeatNum, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RefundSeatBySeatNumResult holds the result of RefundSeatBySeatNum.
+type RefundSeatBySeatNumResult struct {
+	SeatsReserved []uint32 `json:"seatsReserved"`
+}
+
+func (m *RefundSeatBySeatNumResult) Encode(e *marshal.Encoder) {
+	e.WriteUint32Array(m.SeatsReserved)
+}
+
+func (m *RefundSeatBySeatNumResult) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.SeatsReserved, err = d.ReadUint32Array(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func handleRefundSeatBySeatNum(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {
+	var args RefundSeatBySeatNumArgs
+	if err := req.DecodePayload(&args); err != nil {
+		return malformedRequest(err), nil
+	}
+
+	status, result := RefundSeatBySeatNumHandler(&args, fdb, client)
+	if result == nil {
+		return status, nil
+	}
+	return status, result
+}
+
+// SeatAvailabilityNotification holds the body of the SeatAvailability notification.
+type SeatAvailabilityNotification struct {
+	Id        uint32 `json:"id"`
+	SeatsLeft uint32 `json:"seatsLeft"`
+}
+
+func (m *SeatAvailabilityNotification) Encode(e *marshal.Encoder) {
+	e.WriteUint32(m.Id)
+	e.WriteUint32(m.SeatsLeft)
+}
+
+func (m *SeatAvailabilityNotification) Decode(d *marshal.Decoder) error {
+	var err error
+	if m.Id, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	if m.SeatsLeft, err = d.ReadUint32(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RegisterRoutes binds every operation in flights.idl to its handler.
+func RegisterRoutes(router *FlightsRouter) {
+	router.HandleFunc(SelectorGetFlights, handleGetFlights)
+	router.HandleFunc(SelectorGetFlightById, handleGetFlightById)
+	router.HandleFunc(SelectorReserveFlight, handleReserveFlight)
+	router.HandleFunc(SelectorSubscribeFlightById, handleSubscribeFlightById)
+	router.HandleFunc(SelectorGetSeatsById, handleGetSeatsById)
+	router.HandleFunc(SelectorRefundSeatBySeatNum, handleRefundSeatBySeatNum)
+}
+
+// Operations describes every operation in flights.idl, keyed by selector.
+var Operations = map[uint32]Operation{
+	SelectorGetFlights: {
+		Name:         "GetFlights",
+		Selector:     SelectorGetFlights,
+		NewArgs:      func() Message { return &GetFlightsArgs{} },
+		NewResult:    func() Message { return &GetFlightsResult{} },
+		ResultAlways: false,
+		Idempotent:   true,
+	},
+	SelectorGetFlightById: {
+		Name:         "GetFlightById",
+		Selector:     SelectorGetFlightById,
+		NewArgs:      func() Message { return &GetFlightByIdArgs{} },
+		NewResult:    func() Message { return &GetFlightByIdResult{} },
+		ResultAlways: false,
+		Idempotent:   true,
+	},
+	SelectorReserveFlight: {
+		Name:         "ReserveFlight",
+		Selector:     SelectorReserveFlight,
+		NewArgs:      func() Message { return &ReserveFlightArgs{} },
+		NewResult:    func() Message { return &ReserveFlightResult{} },
+		ResultAlways: false,
+	},
+	SelectorSubscribeFlightById: {
+		Name:         "SubscribeFlightById",
+		Selector:     SelectorSubscribeFlightById,
+		NewArgs:      func() Message { return &SubscribeFlightByIdArgs{} },
+		NewResult:    func() Message { return &SubscribeFlightByIdResult{} },
+		ResultAlways: true,
+	},
+	SelectorGetSeatsById: {
+		Name:         "GetSeatsById",
+		Selector:     SelectorGetSeatsById,
+		NewArgs:      func() Message { return &GetSeatsByIdArgs{} },
+		NewResult:    func() Message { return &GetSeatsByIdResult{} },
+		ResultAlways: false,
+		Idempotent:   true,
+	},
+	SelectorRefundSeatBySeatNum: {
+		Name:         "RefundSeatBySeatNum",
+		Selector:     SelectorRefundSeatBySeatNum,
+		NewArgs:      func() Message { return &RefundSeatBySeatNumArgs{} },
+		NewResult:    func() Message { return &RefundSeatBySeatNumResult{} },
+		ResultAlways: false,
+	},
+}
+
+// HTTPRoutes lists the operations in flights.idl exposed over HTTP.
+var HTTPRoutes = []HTTPRoute{
+	{Method: "GET", Path: "/flights", Selector: SelectorGetFlights},
+	{Method: "GET", Path: "/flights/:id", Selector: SelectorGetFlightById},
+	{Method: "POST", Path: "/flights/:id/reservations", Selector: SelectorReserveFlight},
+	{Method: "POST", Path: "/flights/:id/subscriptions", Selector: SelectorSubscribeFlightById},
+	{Method: "GET", Path: "/flights/:id/seats", Selector: SelectorGetSeatsById},
+	{Method: "DELETE", Path: "/flights/:id/seats/:seatNum", Selector: SelectorRefundSeatBySeatNum},
+}
+
+// Notifications describes every notification in flights.idl, keyed by selector.
+var Notifications = map[uint32]Notification{
+	SelectorSeatAvailability: {
+		Name:     "SeatAvailability",
+		Selector: SelectorSeatAvailability,
+		New:      func() Message { return &SeatAvailabilityNotification{} },
+	},
+}
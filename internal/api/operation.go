@@ -0,0 +1,46 @@
+package api
+
+import (
+	_ "embed"
+
+	"goflysys/pkg/marshal"
+)
+
+//go:generate go run goflysys/cmd/gfsidl -in flights.idl -out flights_gen.go -openapi openapi.json
+
+// OpenAPI is the OpenAPI document of the operations in HTTPRoutes.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// Message is implemented by every argument, result and notification type
+// generated from flights.idl.
+type Message interface {
+	Encode(e *marshal.Encoder)
+	Decode(d *marshal.Decoder) error
+}
+
+// Operation describes one function of the protocol as declared in flights.idl.
+type Operation struct {
+	Name         string
+	Selector     uint32
+	NewArgs      func() Message
+	NewResult    func() Message
+	ResultAlways bool
+	Idempotent   bool
+}
+
+// HTTPRoute exposes an operation over HTTP. Path segments of the form :name
+// are filled into the argument of that name.
+type HTTPRoute struct {
+	Method   string
+	Path     string
+	Selector uint32
+}
+
+// Notification describes one unsolicited message sent to subscribers.
+type Notification struct {
+	Name     string
+	Selector uint32
+	New      func() Message
+}
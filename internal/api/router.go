@@ -1,170 +1,158 @@
 package api
 
 import (
-	"bytes"
 	"log"
 	"time"
 
-	"goflysys/pkg/marshal"
+	"goflysys/pkg/codec"
 )
 
+// Route decodes the arguments of one function from Request and returns the
+// status and result of the reply. The result is nil when the reply has none;
+// the caller encodes it with the codec of the request.
+type Route func(Request *codec.Body, fdb *FlightDatabase, client Client) (uint32, any)
+
 type FlightsRouter struct {
-	Routes map[uint32]func(Response *[]byte, Request []byte, fdb *FlightDatabase, user string) []byte
+	Routes map[uint32]Route
+	// Semantics applies to every route without an entry in SemanticsFor.
+	Semantics    Semantics
+	SemanticsFor map[uint32]Semantics
 }
 
 func NewFlightsRouter() *FlightsRouter {
 	return &FlightsRouter{
-		Routes: make(map[uint32]func(Response *[]byte, Request []byte, fdb *FlightDatabase, user string) []byte),
+		Routes:       make(map[uint32]Route),
+		Semantics:    AtMostOnce,
+		SemanticsFor: make(map[uint32]Semantics),
 	}
 }
 
-func (r *FlightsRouter) HandleFunc(path uint32, handler func(Response *[]byte, Request []byte, fdb *FlightDatabase, user string) []byte) {
+func (r *FlightsRouter) HandleFunc(path uint32, handler Route) {
 	r.Routes[path] = handler
 }
 
-func GetFlightsHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
+// SemanticsOf returns the invocation semantics of the route for path.
+func (r *FlightsRouter) SemanticsOf(path uint32) Semantics {
+	if s, ok := r.SemanticsFor[path]; ok {
+		return s
+	}
+	return r.Semantics
+}
 
-	source := marshal.UnmarshalString(data)
-	destination := marshal.UnmarshalString(data[4+len(source):])
+// CachesReplies reports whether replies to path must be kept to answer
+// duplicates: only at-most-once routes that are not idempotent need to be,
+// since re-executing an idempotent operation gives the same outcome.
+func (r *FlightsRouter) CachesReplies(path uint32) bool {
+	if r.SemanticsOf(path) != AtMostOnce {
+		return false
+	}
+	op, ok := Operations[path]
+	return ok && !op.Idempotent
+}
 
-	flights, err := fdb.GetFlights(source, destination)
+// malformedRequest answers a request whose arguments could not be decoded.
+func malformedRequest(err error) uint32 {
+	log.Printf("[SERVICE] Malformed request: %v", err)
+	return StatusBadRequest
+}
+
+func GetFlightsHandler(args *GetFlightsArgs, fdb *FlightDatabase, client Client) (uint32, *GetFlightsResult) {
+	flights, err := fdb.GetFlights(args.Source, args.Destination)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] No flights found")
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404))}, []byte{})
-		return res
+		return StatusNotFound, nil
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400))}, []byte{})
-		return res
+		return StatusBadRequest, nil
 	}
 
-	var flightids []byte
-	count := 0
+	flightids := make([]uint32, 0, len(flights))
 	for _, flight := range flights {
-		count++
-		flightids = append(flightids, marshal.MarshalUint32(flight.id)...)
+		flightids = append(flightids, flight.id)
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(200)), marshal.MarshalUint32(uint32(count)), flightids}, []byte{})
-	return res
+	return StatusOK, &GetFlightsResult{FlightIds: flightids}
 }
 
-func GetFlightByIdHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
-
-	id := marshal.UnmarshalUint32(data[:4])
-	flight, err := fdb.GetFlightById(id)
+func GetFlightByIdHandler(args *GetFlightByIdArgs, fdb *FlightDatabase, client Client) (uint32, *GetFlightByIdResult) {
+	flight, err := fdb.GetFlightById(args.Id)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] Flight given does not exist", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404))}, []byte{})
-		return res
+		return StatusNotFound, nil
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400))}, []byte{})
-		return res
+		return StatusBadRequest, nil
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(200)), marshal.MarshalInt64(flight.departureTime.Unix()), marshal.MarshalFloat64(flight.price), marshal.MarshalUint32(flight.seatsLeft)}, []byte{})
-	return res
+	return StatusOK, &GetFlightByIdResult{
+		DepartureTime: flight.departureTime.Unix(),
+		Price:         flight.price,
+		SeatsLeft:     flight.seatsLeft,
+	}
 }
 
-func ReserveFlightHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
-
-	id := marshal.UnmarshalUint32(data[:4])
-	numSeats := marshal.UnmarshalUint32(data[4:8])
-
-	seatsReserved, err := fdb.ReserveFlight(id, numSeats, user)
+func ReserveFlightHandler(args *ReserveFlightArgs, fdb *FlightDatabase, client Client) (uint32, *ReserveFlightResult) {
+	seatsReserved, err := fdb.ReserveFlight(args.Id, args.NumSeats, client.ID)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] Flight given does not exist", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404))}, []byte{})
-		return res
+		return StatusNotFound, nil
 	}
 	if err != nil && err.Error() == "Conflict" {
 		log.Println("[SERVICE] No flights seats available", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(409))}, []byte{})
-		return res
+		return StatusConflict, nil
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400))}, []byte{})
-		return res
+		return StatusBadRequest, nil
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(201)), marshal.MarshalUint32Array(seatsReserved)}, []byte{})
-	return res
+	return StatusCreated, &ReserveFlightResult{SeatsReserved: seatsReserved}
 }
 
-func SubscribeFlightByIdHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
-
-	id := marshal.UnmarshalUint32(data[:4])
-	endTime := time.Unix(marshal.UnmarshalInt64(data[4:12]), 0)
-
-	_, err := fdb.SubscribeFlightById(id, endTime, user)
+func SubscribeFlightByIdHandler(args *SubscribeFlightByIdArgs, fdb *FlightDatabase, client Client) (uint32, *SubscribeFlightByIdResult) {
+	_, err := fdb.SubscribeFlightById(args.Id, time.Unix(args.EndTime, 0), client)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] Flight given does not exist", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404)), marshal.MarshalBool(false)}, []byte{})
-		return res
+		return StatusNotFound, &SubscribeFlightByIdResult{Subscribed: false}
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400)), marshal.MarshalBool(false)}, []byte{})
-		return res
+		return StatusBadRequest, &SubscribeFlightByIdResult{Subscribed: false}
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(201)), marshal.MarshalBool(true)}, []byte{})
-	return res
+	return StatusCreated, &SubscribeFlightByIdResult{Subscribed: true}
 }
 
-func GetSeatsByIdHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
-
-	id := marshal.UnmarshalUint32(data[:4])
-
-	seatsReserved, err := fdb.GetSeatsById(id, user)
+func GetSeatsByIdHandler(args *GetSeatsByIdArgs, fdb *FlightDatabase, client Client) (uint32, *GetSeatsByIdResult) {
+	seatsReserved, err := fdb.GetSeatsById(args.Id, client.ID)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] Flight given does not exist", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404))}, []byte{})
-		return res
+		return StatusNotFound, nil
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400))}, []byte{})
-		return res
+		return StatusBadRequest, nil
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(200)), marshal.MarshalUint32Array(seatsReserved)}, []byte{})
-	return res
+	return StatusOK, &GetSeatsByIdResult{SeatsReserved: seatsReserved}
 }
 
-func RefundSeatBySeatNumHandler(res_pointer *[]byte, data []byte, fdb *FlightDatabase, user string) []byte {
-	res := *res_pointer
-
-	id := marshal.UnmarshalUint32(data[:4])
-	seatNum := marshal.UnmarshalUint32(data[4:8])
-
-	seatsLeft, err := fdb.RefundSeatBySeatNum(id, seatNum, user)
+func RefundSeatBySeatNumHandler(args *RefundSeatBySeatNumArgs, fdb *FlightDatabase, client Client) (uint32, *RefundSeatBySeatNumResult) {
+	seatsLeft, err := fdb.RefundSeatBySeatNum(args.Id, args.SeatNum, client.ID)
 	if err != nil && err.Error() == "NotFoundException" {
 		log.Println("[SERVICE] Flight given does not exist", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(404))}, []byte{})
-		return res
+		return StatusNotFound, nil
 	}
 	if err != nil && err.Error() == "UnauthorizedException" {
 		log.Println("[SERVICE] User is not the buyer", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(401))}, []byte{})
-		return res
+		return StatusUnauthorized, nil
 	}
 	if err != nil {
 		log.Printf("[SERVICE ERROR] %v", err)
-		res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(400))}, []byte{})
-		return res
+		return StatusBadRequest, nil
 	}
 
-	res = bytes.Join([][]byte{res, marshal.MarshalUint32(uint32(201)), marshal.MarshalUint32Array(seatsLeft)}, []byte{})
-
-	return res
+	return StatusCreated, &RefundSeatBySeatNumResult{SeatsReserved: seatsLeft}
 }
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Semantics is how the server treats a request it has already executed, as
+// recognised by its request id and client.
+type Semantics int
+
+const (
+	// AtMostOnce replays the cached reply to a duplicate instead of running
+	// the handler again.
+	AtMostOnce Semantics = iota
+	// AtLeastOnce runs the handler again for every duplicate, so a
+	// retransmitted ReserveFlight books its seats twice.
+	AtLeastOnce
+)
+
+func (s Semantics) String() string {
+	switch s {
+	case AtMostOnce:
+		return "at-most-once"
+	case AtLeastOnce:
+		return "at-least-once"
+	default:
+		return fmt.Sprintf("Semantics(%d)", int(s))
+	}
+}
+
+// ParseSemantics parses "at-most-once" or "at-least-once".
+func ParseSemantics(text string) (Semantics, error) {
+	switch text {
+	case "at-most-once":
+		return AtMostOnce, nil
+	case "at-least-once":
+		return AtLeastOnce, nil
+	default:
+		return 0, fmt.Errorf("unknown invocation semantics %q", text)
+	}
+}
+
+// ParseSemanticsOverrides parses a comma-separated list of operation=semantics
+// pairs such as "ReserveFlight=at-least-once,6=at-most-once", where the
+// operation is given by name or selector.
+func ParseSemanticsOverrides(text string) (map[uint32]Semantics, error) {
+	overrides := make(map[uint32]Semantics)
+	if text == "" {
+		return overrides, nil
+	}
+
+	for _, pair := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid semantics override %q, want operation=semantics", pair)
+		}
+		selector, err := lookupSelector(name)
+		if err != nil {
+			return nil, err
+		}
+		semantics, err := ParseSemantics(value)
+		if err != nil {
+			return nil, err
+		}
+		overrides[selector] = semantics
+	}
+
+	return overrides, nil
+}
+
+func lookupSelector(name string) (uint32, error) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil {
+		if _, ok := Operations[uint32(n)]; ok {
+			return uint32(n), nil
+		}
+	}
+	for selector, op := range Operations {
+		if op.Name == name {
+			return selector, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operation %q", name)
+}
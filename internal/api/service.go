@@ -1,15 +1,16 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"sync"
 	"time"
 
+	"goflysys/pkg/codec"
 	"goflysys/pkg/marshal"
 
 	"github.com/hashicorp/go-memdb"
@@ -27,7 +28,9 @@ type Flight struct {
 }
 
 type Subscriber struct {
+	client     string
 	listenAddr string
+	via        Sender
 	endTime    time.Time
 }
 
@@ -38,6 +41,21 @@ type Seat struct {
 
 type FlightDatabase struct {
 	db *memdb.MemDB
+	// notifying tracks the notifications still being sent
+	notifying sync.WaitGroup
+}
+
+// clone returns a copy of f that a write transaction can modify. Objects in
+// memdb are shared with concurrent readers, so they are never changed in
+// place: writers insert a modified clone instead.
+func (f *Flight) clone() *Flight {
+	c := *f
+	c.seats = make(map[uint32]Seat, len(f.seats))
+	for seatNum, seat := range f.seats {
+		c.seats[seatNum] = seat
+	}
+	c.subs = append([]Subscriber(nil), f.subs...)
+	return &c
 }
 
 func NewDatabase(timeout time.Duration) (*FlightDatabase, error) {
@@ -136,58 +154,75 @@ func (fdb *FlightDatabase) GetFlightById(id uint32) (*Flight, error) {
 
 func (fdb *FlightDatabase) ReserveFlight(id uint32, numSeats uint32, buyer string) ([]uint32, error) {
 	txn := fdb.db.Txn(true)
+	defer txn.Abort() //no-op once committed, releases the write lock on errors
 
-	flight, err := txn.First("flights", "id", id)
+	raw, err := txn.First("flights", "id", id)
 	if err != nil {
 		return nil, err
 	}
-	if flight == nil {
+	if raw == nil {
 		return nil, errors.New("NotFoundException")
 	}
+	flight := raw.(*Flight).clone()
 
-	seatsReserved := make([]uint32, int(numSeats))
-	count := 0
-	seats := flight.(*Flight).seats
+	//numSeats comes off the wire: bound it before allocating anything
+	if numSeats == 0 {
+		return nil, errors.New("cannot reserve 0 seats")
+	}
+	if numSeats > flight.seatsLeft {
+		return nil, errors.New("Conflict")
+	}
+
+	seatsReserved := make([]uint32, 0, numSeats)
+	seats := raw.(*Flight).seats
 	for seatNum, seat := range seats {
-		if count >= int(numSeats) {
+		if len(seatsReserved) >= int(numSeats) {
 			break
 		}
 		if !seat.reserved {
-			seatsReserved[count] = seatNum
-			flight.(*Flight).seats[seatNum] = Seat{reserved: true, buyer: buyer}
-			flight.(*Flight).seatsLeft--
-			count++
+			seatsReserved = append(seatsReserved, seatNum)
+			flight.seats[seatNum] = Seat{reserved: true, buyer: buyer}
+			flight.seatsLeft--
 		}
 	}
 
-	if count == 0 {
-		return nil, errors.New("Conflict")
-	}
-
 	if txn.Insert("flights", flight); err != nil {
 		return nil, err
 	}
 
-	go publishToSubscribers(flight.(*Flight).subs, flight.(*Flight).id, flight.(*Flight).seatsLeft)
-
 	txn.Commit()
 
+	fdb.notifying.Add(1)
+	go func() {
+		defer fdb.notifying.Done()
+		publishToSubscribers(flight.subs, flight.id, flight.seatsLeft)
+	}()
+
 	return seatsReserved, nil
 }
 
-func (fdb *FlightDatabase) SubscribeFlightById(id uint32, endTime time.Time, subscriber string) (*Flight, error) {
-	newSub := Subscriber{listenAddr: subscriber, endTime: endTime}
+func (fdb *FlightDatabase) SubscribeFlightById(id uint32, endTime time.Time, subscriber Client) (*Flight, error) {
+	newSub := Subscriber{client: subscriber.ID, listenAddr: subscriber.Addr, via: subscriber.Via, endTime: endTime}
 	txn := fdb.db.Txn(true)
+	defer txn.Abort() //no-op once committed, releases the write lock on errors
 
-	flight, err := txn.First("flights", "id", id)
+	raw, err := txn.First("flights", "id", id)
 	if err != nil {
 		return nil, err
 	}
-	if flight == nil {
+	if raw == nil {
 		return nil, errors.New("NotFoundException")
 	}
+	flight := raw.(*Flight).clone()
 
-	flight.(*Flight).subs = append(flight.(*Flight).subs, newSub)
+	//a client subscribing again replaces its subscription, picking up its new address
+	subs := make([]Subscriber, 0, len(flight.subs)+1)
+	for _, sub := range flight.subs {
+		if sub.client != newSub.client {
+			subs = append(subs, sub)
+		}
+	}
+	flight.subs = append(subs, newSub)
 
 	if txn.Insert("flights", flight); err != nil {
 		return nil, errors.New("BadRequestException")
@@ -256,14 +291,23 @@ func (fdb *FlightDatabase) RefundSeatBySeatNum(id uint32, seatNum uint32, flyer
 		return nil, errors.New("UnauthorizedException")
 	}
 
-	raw.(*Flight).seats[seatNum] = Seat{reserved: false, buyer: ""}
+	flight := raw.(*Flight).clone()
+	flight.seats[seatNum] = Seat{reserved: false, buyer: ""}
+	flight.seatsLeft++
 
-	if txn.Insert("flights", raw); err != nil {
+	if txn.Insert("flights", flight); err != nil {
 		return nil, err
 	}
 
 	txn.Commit()
 
+	//flight is reused below, so hand the notification its own copies
+	fdb.notifying.Add(1)
+	go func(subs []Subscriber, id, seatsLeft uint32) {
+		defer fdb.notifying.Done()
+		publishToSubscribers(subs, id, seatsLeft)
+	}(flight.subs, flight.id, flight.seatsLeft)
+
 	txn = fdb.db.Txn(false)
 	defer txn.Abort()
 
@@ -275,7 +319,7 @@ func (fdb *FlightDatabase) RefundSeatBySeatNum(id uint32, seatNum uint32, flyer
 		return nil, errors.New("NotFoundException")
 	}
 
-	flight := raw.(*Flight)
+	flight = raw.(*Flight)
 	seatsReserved := make([]uint32, 0)
 	for seatNum, seat := range flight.seats {
 		if seat.buyer == flyer {
@@ -315,11 +359,9 @@ func boostrapDatabase(db *memdb.MemDB) {
 
 	for _, f := range flights {
 		seatMap := make(map[uint32]Seat, 100)
-		go func() {
-			for i := uint32(0); i <= 100; i++ {
-				seatMap[i] = Seat{reserved: false, buyer: ""}
-			}
-		}()
+		for i := uint32(0); i <= 100; i++ {
+			seatMap[i] = Seat{reserved: false, buyer: ""}
+		}
 		f.seats = seatMap
 		if err := txn.Insert("flights", f); err != nil {
 			log.Fatal(err)
@@ -329,21 +371,58 @@ func boostrapDatabase(db *memdb.MemDB) {
 	txn.Commit()
 }
 
+// WaitNotifications waits until the notifications of every reservation made
+// so far have been sent, or ctx is done.
+func (fdb *FlightDatabase) WaitNotifications(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		fdb.notifying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func publishToSubscribers(subs []Subscriber, id uint32, numSeats uint32) {
+	// subscriptions do not record the subscriber's codec, so
+	// notifications always go out in plain CDR
+	envelope := marshal.NewEnvelope(marshal.MessageNotification, marshal.FlagChecksum)
+	notification := SeatAvailabilityNotification{Id: id, SeatsLeft: numSeats}
+	body, _ := codec.CDR.Encode(marshal.MessageNotification, 0, SelectorSeatAvailability, &notification)
+	message := envelope.Seal(body)
+
 	now := time.Now()
 	for _, sub := range subs {
 		log.Printf("EndTime for user %s is: %s", sub.listenAddr, sub.endTime.String())
 		if now.Before(sub.endTime) {
-			sendAddr, _ := net.ResolveUDPAddr("udp", sub.listenAddr)
-			ln, err := net.DialUDP("udp", nil, sendAddr) //don't care if the user is listening, just send
-			if err != nil {
+			log.Printf("Sending notification to user %s\n", sub.listenAddr)
+			if err := notify(sub, message); err != nil {
 				log.Printf("Failed to send notification to user %s: %v\n", sub.listenAddr, err)
-			} else {
-				resp := bytes.Join([][]byte{marshal.MarshalUint32(uint32(8888)), marshal.MarshalUint32(id), marshal.MarshalUint32(numSeats)}, []byte{})
-				log.Printf("Sending notification to user %s\n", sub.listenAddr)
-				ln.Write(resp)
 			}
-			defer ln.Close()
 		}
 	}
 }
+
+// notify sends message to sub over the transport it subscribed on, or from a
+// fresh UDP socket if that is unknown.
+func notify(sub Subscriber, message []byte) error {
+	if sub.via != nil {
+		return sub.via.Send(sub.listenAddr, message)
+	}
+
+	sendAddr, err := net.ResolveUDPAddr("udp", sub.listenAddr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.DialUDP("udp", nil, sendAddr) //don't care if the user is listening, just send
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	_, err = ln.Write(message)
+	return err
+}
@@ -0,0 +1,85 @@
+// Package dispatcher runs requests on a fixed pool of workers. Requests with
+// the same key, which the server sets to the client identity, always go to
+// the same worker and so run one at a time in arrival order, while requests
+// from different clients run in parallel.
+package dispatcher
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Dispatcher queues jobs for its workers. Its methods may be called from
+// several goroutines, but Close must be the last call.
+type Dispatcher struct {
+	queues  []chan func()
+	wg      sync.WaitGroup
+	pending atomic.Int64
+}
+
+// New starts workers workers, each with a queue of depth jobs. Submit blocks
+// while the queue of a job's worker is full, which pushes back on the
+// receive loop instead of buffering without bound.
+func New(workers, depth int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &Dispatcher{queues: make([]chan func(), workers)}
+	for i := range d.queues {
+		d.queues[i] = make(chan func(), depth)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+func (d *Dispatcher) work(queue chan func()) {
+	defer d.wg.Done()
+	for job := range queue {
+		job()
+		d.pending.Add(-1)
+	}
+}
+
+// Submit queues job behind the earlier jobs with the same key.
+func (d *Dispatcher) Submit(key string, job func()) {
+	d.pending.Add(1)
+	d.queue(key) <- job
+}
+
+// TrySubmit queues job like Submit if its worker's queue has room, and
+// reports whether it did.
+func (d *Dispatcher) TrySubmit(key string, job func()) bool {
+	d.pending.Add(1)
+	select {
+	case d.queue(key) <- job:
+		return true
+	default:
+		d.pending.Add(-1)
+		return false
+	}
+}
+
+func (d *Dispatcher) queue(key string) chan func() {
+	return d.queues[xxhash.Sum64String(key)%uint64(len(d.queues))]
+}
+
+// Pending returns the number of jobs queued or running.
+func (d *Dispatcher) Pending() int {
+	return int(d.pending.Load())
+}
+
+// Workers returns the number of workers.
+func (d *Dispatcher) Workers() int {
+	return len(d.queues)
+}
+
+// Close waits for every queued job to finish and stops the workers.
+func (d *Dispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
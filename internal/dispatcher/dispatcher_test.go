@@ -0,0 +1,186 @@
+package dispatcher
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/marshal"
+)
+
+func TestSameKeyRunsInOrder(t *testing.T) {
+	const keys, jobs = 16, 200
+	d := New(4, 8)
+
+	var mu sync.Mutex
+	ran := make(map[string][]int)
+	for i := 0; i < jobs; i++ {
+		for k := 0; k < keys; k++ {
+			key, i := fmt.Sprint("client-", k), i
+			d.Submit(key, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				ran[key] = append(ran[key], i)
+			})
+		}
+	}
+	d.Close()
+
+	for key, order := range ran {
+		if len(order) != jobs {
+			t.Errorf("%s: ran %d jobs, want %d", key, len(order), jobs)
+		}
+		for i, job := range order {
+			if job != i {
+				t.Errorf("%s: job %d ran in position %d", key, job, i)
+				break
+			}
+		}
+	}
+}
+
+func TestSameKeyRunsOneAtATime(t *testing.T) {
+	d := New(8, 8)
+	var running, overlaps int
+	var mu sync.Mutex
+	for i := 0; i < 100; i++ {
+		d.Submit("client", func() {
+			mu.Lock()
+			running++
+			if running > 1 {
+				overlaps++
+			}
+			mu.Unlock()
+			runtime.Gosched()
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	d.Close()
+	if overlaps > 0 {
+		t.Errorf("jobs with the same key overlapped %d times", overlaps)
+	}
+}
+
+func TestTrySubmitFullQueue(t *testing.T) {
+	d := New(1, 1)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	d.Submit("a", func() { close(started); <-block })
+	<-started
+	if !d.TrySubmit("a", func() {}) {
+		t.Fatal("TrySubmit refused a job with room in the queue")
+	}
+	if d.TrySubmit("a", func() {}) {
+		t.Error("TrySubmit queued a job on a full queue")
+	}
+	if n := d.Pending(); n != 2 {
+		t.Errorf("Pending() = %d, want 2", n)
+	}
+	close(block)
+	d.Close()
+}
+
+// request is one encoded request of the dispatch workload.
+type request struct {
+	client string
+	body   []byte
+}
+
+// workload returns requests from clients clients that look up, reserve and
+// list seats on the seeded flights, the way booking clients do.
+func workload(b *testing.B, clients int) []request {
+	var requests []request
+	for c := 0; c < clients; c++ {
+		client := fmt.Sprintf("client-%016x", c)
+		flight := uint32(c%21 + 1)
+		calls := []struct {
+			selector uint32
+			args     any
+		}{
+			{api.SelectorGetFlightById, &api.GetFlightByIdArgs{Id: flight}},
+			{api.SelectorReserveFlight, &api.ReserveFlightArgs{Id: flight, NumSeats: 1}},
+			{api.SelectorGetSeatsById, &api.GetSeatsByIdArgs{Id: flight}},
+		}
+		for i, call := range calls {
+			body, err := codec.CDR.Encode(marshal.MessageRequest, uint32(i+1), call.selector, call.args)
+			if err != nil {
+				b.Fatal(err)
+			}
+			requests = append(requests, request{client: client, body: body})
+		}
+	}
+	return requests
+}
+
+// BenchmarkDispatch compares handling requests one at a time, as the receive
+// loop used to, with the worker pool, running the real handlers against the
+// flight database.
+func BenchmarkDispatch(b *testing.B) {
+	router := api.NewFlightsRouter()
+	api.RegisterRoutes(router)
+	requests := workload(b, 1000)
+
+	// handlers log every sold-out flight, which would measure the terminal
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// every run starts from a fresh database, so that each sells the same
+	// seats; NewDatabase prints the flights, which would garble the results
+	newHandler := func(b *testing.B) func(request) {
+		stdout := os.Stdout
+		os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		db, err := api.NewDatabase(10 * time.Second)
+		os.Stdout.Close()
+		os.Stdout = stdout
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		return func(req request) {
+			body, err := codec.CDR.Decode(marshal.MessageRequest, req.body)
+			if err != nil {
+				panic(err)
+			}
+			status, result := router.Routes[body.Code](body, db, api.Client{ID: req.client, Addr: req.client})
+			if _, err := codec.CDR.Encode(marshal.MessageReply, body.ID, status, result); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	b.Run("loop", func(b *testing.B) {
+		handle := newHandler(b)
+		for i := 0; i < b.N; i++ {
+			handle(requests[i%len(requests)])
+		}
+	})
+	for _, workers := range workerCounts() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			handle := newHandler(b)
+			d := New(workers, 64)
+			for i := 0; i < b.N; i++ {
+				req := requests[i%len(requests)]
+				d.Submit(req.client, func() { handle(req) })
+			}
+			d.Close()
+		})
+	}
+}
+
+func workerCounts() []int {
+	counts := []int{1}
+	for n := 4; n < runtime.NumCPU()*4; n *= 2 {
+		counts = append(counts, n)
+	}
+	return append(counts, runtime.NumCPU()*4)
+}
@@ -0,0 +1,309 @@
+// Package gateway serves the operations of flights.idl that have an http line
+// as a REST API with JSON bodies. Requests go to the same FlightsRouter routes
+// and FlightDatabase as those arriving over UDP or TCP, so both gateways share
+// every business rule.
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/pkg/codec"
+	"goflysys/pkg/marshal"
+	"goflysys/pkg/ratelimit"
+)
+
+// MaxBody is the largest request body the gateway reads.
+const MaxBody = 1 << 20
+
+// Headers a request may carry.
+const (
+	// HeaderClientID holds up to 16 hex digits identifying the client, as
+	// the clientId of the UDP protocol does. Without it the client is
+	// identified by its address.
+	HeaderClientID = "X-Client-Id"
+	// HeaderNotifyAddr is the UDP address notifications are sent to for a
+	// subscription, on the same IP as the connection. Without it they go to
+	// the address of the connection.
+	HeaderNotifyAddr = "X-Notify-Addr"
+)
+
+// Gateway is an http.Handler for the routes in api.HTTPRoutes, plus
+// GET /openapi.json for the document describing them.
+//
+// Requests over HTTP carry no request id, so they are never deduplicated: a
+// client that retries a request that is not idempotent may run it twice.
+type Gateway struct {
+	router *api.FlightsRouter
+	db     *api.FlightDatabase
+	// Limiter, if set, sheds requests of clients over their rate limit with
+	// 503 Service Unavailable. Clients are limited by their IP, since
+	// HeaderClientID is not authenticated.
+	Limiter *ratelimit.Limiter
+	// OnShed, if set, is called for every request shed by Limiter.
+	OnShed func(selector uint32)
+}
+
+func New(router *api.FlightsRouter, db *api.FlightDatabase) *Gateway {
+	return &Gateway{router: router, db: db}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.json" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(api.OpenAPI)
+		return
+	}
+
+	route, params, allowed := match(r.Method, r.URL.Path)
+	if route == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, http.StatusMethodNotAllowed)
+		} else {
+			writeError(w, http.StatusNotFound)
+		}
+		return
+	}
+
+	client, err := clientOf(r)
+	if err != nil {
+		log.Printf("[HTTP %s] Rejecting request: %v", r.RemoteAddr, err)
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	req, err := decodeRequest(r, route, params)
+	if err != nil {
+		fmt.Printf("[HTTP %s] Malformed %s %s: %v\n", client, r.Method, r.URL.Path, err)
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	fmt.Printf("[HTTP %s] %s %s for function %d\n", client, r.Method, r.URL.Path, route.Selector)
+
+	//a client over its rate limit is told so instead of being served
+	status, result := api.StatusBadRequest, any(nil)
+	if g.Limiter != nil && !g.Limiter.Allow(ratelimit.HostKey(r.RemoteAddr), route.Selector) {
+		fmt.Printf("[HTTP %s] Shedding request: rate limit exceeded\n", client)
+		if g.OnShed != nil {
+			g.OnShed(route.Selector)
+		}
+		status = api.StatusOverloaded
+	} else if handler, ok := g.router.Routes[route.Selector]; ok {
+		status, result = handler(req, g.db, client)
+	} else {
+		fmt.Println("function cannot be handled")
+	}
+
+	writeReply(w, status, result)
+}
+
+// match returns the route for method and path with the values of its path
+// parameters, or nil and the methods path does accept.
+func match(method, path string) (*api.HTTPRoute, map[string]string, []string) {
+	segments := strings.Split(path, "/")
+	var allowed []string
+	for i := range api.HTTPRoutes {
+		route := &api.HTTPRoutes[i]
+		params, ok := matchPath(route.Path, segments)
+		if !ok {
+			continue
+		}
+		if route.Method == method {
+			return route, params, nil
+		}
+		allowed = append(allowed, route.Method)
+	}
+	return nil, nil, allowed
+}
+
+// matchPath reports whether segments fit pattern, and returns the values of
+// its :name segments.
+func matchPath(pattern string, segments []string) (map[string]string, bool) {
+	want := strings.Split(pattern, "/")
+	if len(want) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, w := range want {
+		if strings.HasPrefix(w, ":") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[w[1:]] = segments[i]
+		} else if w != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// clientOf returns the client that sent r, identified as a UDP client with
+// the same id would be, or by the address of the connection. HeaderNotifyAddr
+// only chooses where notifications go, and must be on the caller's own IP so
+// that the gateway cannot be used to send datagrams to other hosts.
+func clientOf(r *http.Request) (api.Client, error) {
+	env := marshal.NewEnvelope(marshal.MessageRequest, marshal.CodecJSON)
+	if text := r.Header.Get(HeaderClientID); text != "" {
+		id, err := strconv.ParseUint(text, 16, 64)
+		if err != nil {
+			return api.Client{}, fmt.Errorf("invalid %s %q", HeaderClientID, text)
+		}
+		env = env.WithClientID(id)
+	}
+	// notifications go over UDP
+	client := api.ClientOf(env, r.RemoteAddr, nil)
+
+	if notify := r.Header.Get(HeaderNotifyAddr); notify != "" {
+		host, _, err := net.SplitHostPort(notify)
+		if err != nil {
+			return api.Client{}, fmt.Errorf("invalid %s %q: %w", HeaderNotifyAddr, notify, err)
+		}
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return api.Client{}, err
+		}
+		ip, remoteIP := net.ParseIP(host), net.ParseIP(remote)
+		if ip == nil || remoteIP == nil || !ip.Equal(remoteIP) {
+			return api.Client{}, fmt.Errorf("%s %s is not on the caller's address %s", HeaderNotifyAddr, notify, remote)
+		}
+		client.Addr = notify
+	}
+	return client, nil
+}
+
+// decodeRequest turns r into the body of a request for route, as if it had
+// arrived over UDP in the JSON codec. The arguments are the fields of the
+// JSON body, if any, then the path parameters and, for GET and DELETE, the
+// query parameters.
+func decodeRequest(r *http.Request, route *api.HTTPRoute, params map[string]string) (*codec.Body, error) {
+	var args map[string]json.RawMessage
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, MaxBody))
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &args); err != nil {
+			return nil, err
+		}
+	}
+	if args == nil {
+		args = make(map[string]json.RawMessage)
+	}
+
+	types := argTypes(api.Operations[route.Selector].NewArgs())
+	values := make(map[string][]string)
+	if r.Method == http.MethodGet || r.Method == http.MethodDelete {
+		for name, v := range r.URL.Query() {
+			values[name] = v
+		}
+	}
+	for name, v := range params {
+		values[name] = []string{v}
+	}
+	for name, v := range values {
+		t, ok := types[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+		if args[name], err = paramJSON(t, v); err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", name, err)
+		}
+	}
+
+	request, err := json.Marshal(map[string]any{"reqId": 0, "selector": route.Selector, "args": args})
+	if err != nil {
+		return nil, err
+	}
+	return codec.JSON.Decode(marshal.MessageRequest, request)
+}
+
+// argTypes returns the type of every field of args, keyed by its JSON name.
+func argTypes(args api.Message) map[string]reflect.Type {
+	t := reflect.TypeOf(args).Elem()
+	types := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		types[name] = t.Field(i).Type
+	}
+	return types
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// paramJSON returns the JSON for the values of a parameter of type t. A
+// slice takes every value of a repeated parameter; anything else only one.
+func paramJSON(t reflect.Type, values []string) (json.RawMessage, error) {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		elems := make([]json.RawMessage, len(values))
+		for i, v := range values {
+			var err error
+			if elems[i], err = paramJSON(t.Elem(), []string{v}); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(elems)
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("given %d times", len(values))
+	}
+
+	v := values[0]
+	if t.Kind() == reflect.String || t.Kind() == reflect.Slice || t == timeType {
+		return json.Marshal(v)
+	}
+	// numbers and booleans; the strict decoding of the request rejects
+	// values that do not fit the type
+	if !json.Valid([]byte(v)) {
+		return nil, fmt.Errorf("invalid value %q", v)
+	}
+	return json.RawMessage(v), nil
+}
+
+// writeReply writes status, as its HTTP code, and result. Statuses without
+// an HTTP meaning become 500 Internal Server Error.
+func writeReply(w http.ResponseWriter, status uint32, result any) {
+	code := int(status)
+	if http.StatusText(code) == "" {
+		code = http.StatusInternalServerError
+	}
+	if result == nil {
+		if code >= 400 {
+			writeError(w, code)
+		} else {
+			writeJSON(w, code, struct{}{})
+		}
+		return
+	}
+	writeJSON(w, code, result)
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	writeJSON(w, code, map[string]string{"error": http.StatusText(code)})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[HTTP] Cannot encode reply: %v", err)
+		code, data = http.StatusInternalServerError, []byte(`{"error":"Internal Server Error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,222 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"goflysys/internal/api"
+	"goflysys/pkg/ratelimit"
+)
+
+func newTestGateway(t *testing.T) *Gateway {
+	t.Helper()
+	// NewDatabase prints the flights
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	db, err := api.NewDatabase(10 * time.Second)
+	os.Stdout.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := api.NewFlightsRouter()
+	api.RegisterRoutes(router)
+	return New(router, db)
+}
+
+// do serves one request from client on g and decodes the JSON reply into
+// result, unless it is nil.
+func do(t *testing.T, g *Gateway, method, target, client, body string, result any) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	req.RemoteAddr = "192.0.2.1:40000"
+	if client != "" {
+		req.Header.Set(HeaderClientID, client)
+	}
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type %q", method, target, ct)
+	}
+	if result != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+	return resp
+}
+
+func TestRouteMatching(t *testing.T) {
+	g := newTestGateway(t)
+	for _, tt := range []struct {
+		method, target string
+		want           int
+	}{
+		{"GET", "/flights?source=CDG&destination=HND", http.StatusOK},
+		{"GET", "/flights/1", http.StatusOK},
+		{"GET", "/flights/1/seats", http.StatusOK},
+		{"GET", "/flights/999", http.StatusNotFound},
+		{"GET", "/flights/", http.StatusNotFound},
+		{"GET", "/flights/1/extra", http.StatusNotFound},
+		{"GET", "/airports", http.StatusNotFound},
+		{"GET", "/openapi.json", http.StatusOK},
+	} {
+		if resp := do(t, g, tt.method, tt.target, "", "", nil); resp.StatusCode != tt.want {
+			t.Errorf("%s %s: %d, want %d", tt.method, tt.target, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	g := newTestGateway(t)
+	for _, tt := range []struct {
+		method, target, allow string
+	}{
+		{"DELETE", "/flights/1", "GET"},
+		{"PUT", "/flights/1/seats/3", "DELETE"},
+		{"GET", "/flights/1/reservations", "POST"},
+		{"POST", "/openapi.json", "GET, HEAD"},
+	} {
+		resp := do(t, g, tt.method, tt.target, "", "", nil)
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: %d, want 405", tt.method, tt.target, resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tt.method, tt.target, allow, tt.allow)
+		}
+	}
+}
+
+func TestParameterDecoding(t *testing.T) {
+	g := newTestGateway(t)
+
+	var flights api.GetFlightsResult
+	do(t, g, "GET", "/flights?source=CDG&destination=HND", "", "", &flights)
+	if len(flights.FlightIds) != 1 || flights.FlightIds[0] != 1 {
+		t.Errorf("flights from CDG to HND: %v, want [1]", flights.FlightIds)
+	}
+
+	// path parameters and the JSON body make up the arguments
+	var reserved api.ReserveFlightResult
+	resp := do(t, g, "POST", "/flights/2/reservations", "1", `{"numSeats": 2}`, &reserved)
+	if resp.StatusCode != http.StatusCreated || len(reserved.SeatsReserved) != 2 {
+		t.Fatalf("reserving 2 seats: %d, %v", resp.StatusCode, reserved.SeatsReserved)
+	}
+	var held api.GetSeatsByIdResult
+	do(t, g, "GET", "/flights/2/seats", "1", "", &held)
+	if len(held.SeatsReserved) != 2 {
+		t.Errorf("client holds seats %v after reserving %v", held.SeatsReserved, reserved.SeatsReserved)
+	}
+
+	for _, tt := range []struct {
+		method, target, body string
+	}{
+		{"GET", "/flights/abc", ""},
+		{"GET", "/flights/4294967296", ""},
+		{"GET", "/flights/1?unknown=1", ""},
+		{"GET", "/flights?source=CDG&source=LHR", ""},
+		{"POST", "/flights/1/reservations", `{"numSeats": "two"}`},
+		{"POST", "/flights/1/reservations", `{"numSeats": 1`},
+	} {
+		if resp := do(t, g, tt.method, tt.target, "", tt.body, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s %s: %d, want 400", tt.method, tt.target, tt.body, resp.StatusCode)
+		}
+	}
+}
+
+func TestStatusMapping(t *testing.T) {
+	g := newTestGateway(t)
+
+	var reserved api.ReserveFlightResult
+	if resp := do(t, g, "POST", "/flights/3/reservations", "1", `{"numSeats": 1}`, &reserved); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("reservation: %d, want 201", resp.StatusCode)
+	}
+	refund := fmt.Sprintf("/flights/3/seats/%d", reserved.SeatsReserved[0])
+	if resp := do(t, g, "DELETE", refund, "2", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("refund of another client's seat: %d, want 401", resp.StatusCode)
+	}
+	var before, after api.GetFlightByIdResult
+	do(t, g, "GET", "/flights/3", "", "", &before)
+	if resp := do(t, g, "DELETE", refund, "1", "", nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("refund: %d, want 201", resp.StatusCode)
+	}
+	do(t, g, "GET", "/flights/3", "", "", &after)
+	if after.SeatsLeft != before.SeatsLeft+1 {
+		t.Errorf("%d seats left after a refund, want %d", after.SeatsLeft, before.SeatsLeft+1)
+	}
+	if resp := do(t, g, "POST", "/flights/3/reservations", "1", `{"numSeats": 0}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reservation of no seats: %d, want 400", resp.StatusCode)
+	}
+
+	var flight api.GetFlightByIdResult
+	do(t, g, "GET", "/flights/3", "", "", &flight)
+	if resp := do(t, g, "POST", "/flights/3/reservations", "1", jsonString(t, map[string]uint32{"numSeats": flight.SeatsLeft + 1}), nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("reservation of more seats than are left: %d, want 409", resp.StatusCode)
+	}
+	// the refunded seat can be reserved again, so every seat can be sold
+	if resp := do(t, g, "POST", "/flights/3/reservations", "1", jsonString(t, map[string]uint32{"numSeats": flight.SeatsLeft}), nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("reservation of every seat left: %d, want 201", resp.StatusCode)
+	}
+	if resp := do(t, g, "POST", "/flights/3/reservations", "1", `{"numSeats": 1}`, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("reservation on a sold-out flight: %d, want 409", resp.StatusCode)
+	}
+
+	limiter, err := ratelimit.New(0.001, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shed []uint32
+	g.Limiter = limiter
+	g.OnShed = func(selector uint32) { shed = append(shed, selector) }
+	if resp := do(t, g, "GET", "/flights/1", "3", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("request within the rate limit: %d, want 200", resp.StatusCode)
+	}
+	// another X-Client-Id from the same IP shares the bucket
+	if resp := do(t, g, "GET", "/flights/1", "4", "", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("request over the rate limit: %d, want 503", resp.StatusCode)
+	}
+	if len(shed) != 1 || shed[0] != api.SelectorGetFlightById {
+		t.Errorf("OnShed called for %v, want [%d]", shed, api.SelectorGetFlightById)
+	}
+}
+
+func TestNotifyAddr(t *testing.T) {
+	g := newTestGateway(t)
+	subscription := fmt.Sprintf(`{"endTime": %d}`, time.Now().Add(time.Hour).Unix())
+	for addr, want := range map[string]int{
+		"192.0.2.1:9999":    http.StatusCreated,
+		"198.51.100.7:9999": http.StatusBadRequest,
+		"192.0.2.1":         http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("POST", "/flights/1/subscriptions", strings.NewReader(subscription))
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set(HeaderNotifyAddr, addr)
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s %s: %d, want %d", HeaderNotifyAddr, addr, w.Code, want)
+		}
+	}
+}
+
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
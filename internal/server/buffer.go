@@ -0,0 +1,31 @@
+package server
+
+import "sync"
+
+// bufferSize is the largest datagram or read the servers accept.
+const bufferSize = 2048
+
+var buffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	},
+}
+
+// getBuffer returns a buffer of bufferSize bytes owned by the caller.
+func getBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+// Release hands the buffer behind msg.Payload back to the server for reuse.
+// It must be called once msg has been handled, and neither msg.Payload nor
+// anything sliced from it may be used afterwards. Releasing a message twice,
+// or one that was built outside the servers, does nothing.
+func (msg *Message) Release() {
+	if msg.buf == nil {
+		return
+	}
+	buffers.Put(msg.buf)
+	msg.buf = nil
+	msg.Payload = nil
+}
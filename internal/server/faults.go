@@ -0,0 +1,329 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultConfig sets how often a Faulty transport injects each fault. Every
+// probability is between 0 and 1 and applies to incoming requests and to
+// outgoing replies and notifications alike.
+type FaultConfig struct {
+	// Drop is the probability that a message is lost.
+	Drop float64
+	// Delay is the probability that a message is held back for up to
+	// MaxDelay.
+	Delay float64
+	// Duplicate is the probability that a message is delivered twice.
+	Duplicate float64
+	// Reorder is the probability that a message is overtaken by the next one
+	// in the same direction, or held back MaxDelay if none follows.
+	Reorder float64
+	// MaxDelay bounds delays, DefaultMaxDelay if zero.
+	MaxDelay time.Duration
+	// Seed seeds the choice of faults, so that a run receiving the same
+	// messages in the same order injects the same faults. Each direction
+	// draws from its own source, so the faults injected into requests do not
+	// depend on how many replies were sent in between. Zero picks a seed from
+	// the clock; it is logged either way.
+	Seed int64
+}
+
+// DefaultMaxDelay bounds delays when FaultConfig.MaxDelay is zero.
+const DefaultMaxDelay = 500 * time.Millisecond
+
+// Enabled reports whether cfg injects any fault at all.
+func (cfg FaultConfig) Enabled() bool {
+	return cfg.Drop > 0 || cfg.Delay > 0 || cfg.Duplicate > 0 || cfg.Reorder > 0
+}
+
+// Validate checks that every probability is between 0 and 1.
+func (cfg FaultConfig) Validate() error {
+	for _, p := range []struct {
+		name string
+		p    float64
+	}{{"drop", cfg.Drop}, {"delay", cfg.Delay}, {"duplicate", cfg.Duplicate}, {"reorder", cfg.Reorder}} {
+		if p.p < 0 || p.p > 1 {
+			return fmt.Errorf("%s probability must be between 0 and 1, got %v", p.name, p.p)
+		}
+	}
+	if cfg.MaxDelay < 0 {
+		return fmt.Errorf("maximum delay must not be negative, got %s", cfg.MaxDelay)
+	}
+	return nil
+}
+
+// Faulty wraps a Transport and drops, delays, duplicates and reorders the
+// messages crossing it, to exercise retransmission, duplicate filtering and
+// reassembly without a misbehaving network. Every fault is logged.
+type Faulty struct {
+	inner Transport
+	cfg   FaultConfig
+	msgs  chan Message
+
+	mu sync.Mutex
+	// rndIn chooses the faults of requests, rndOut of replies
+	rndIn  *rand.Rand
+	rndOut *rand.Rand
+	// held is the message being reordered in each direction, nil if none
+	heldIn  *Message
+	heldOut *heldSend
+
+	// pending tracks delayed requests, sending delayed replies
+	pending sync.WaitGroup
+	sending sync.WaitGroup
+	done    chan struct{} // closed once pump returns
+	err     error         // why inner stopped receiving, if not closed
+}
+
+type heldSend struct {
+	addr string
+	data []byte
+}
+
+// NewFaulty starts receiving from inner and injects faults as set by cfg.
+func NewFaulty(inner Transport, cfg FaultConfig) *Faulty {
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = DefaultMaxDelay
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	log.Printf("[FAULT] Injecting faults: drop %v, delay %v up to %s, duplicate %v, reorder %v, seed %d",
+		cfg.Drop, cfg.Delay, cfg.MaxDelay, cfg.Duplicate, cfg.Reorder, cfg.Seed)
+
+	f := &Faulty{
+		inner:  inner,
+		cfg:    cfg,
+		msgs:   make(chan Message, 10),
+		rndIn:  rand.New(rand.NewSource(cfg.Seed)),
+		rndOut: rand.New(rand.NewSource(^cfg.Seed)),
+		done:   make(chan struct{}),
+	}
+	go f.pump()
+	return f
+}
+
+// faults is the set of faults chosen for one message.
+type faults struct {
+	drop, duplicate, reorder bool
+	delay                    time.Duration
+}
+
+// choose draws the faults for one message from rnd, f.rndIn or f.rndOut.
+func (f *Faulty) choose(rnd *rand.Rand) faults {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ft faults
+	ft.drop = rnd.Float64() < f.cfg.Drop
+	ft.duplicate = rnd.Float64() < f.cfg.Duplicate
+	ft.reorder = rnd.Float64() < f.cfg.Reorder
+	if rnd.Float64() < f.cfg.Delay {
+		ft.delay = time.Duration(rnd.Int63n(int64(f.cfg.MaxDelay)) + 1)
+	}
+	return ft
+}
+
+func (f *Faulty) pump() {
+	defer func() {
+		f.mu.Lock()
+		held := f.heldIn
+		f.heldIn = nil
+		f.mu.Unlock()
+		if held != nil {
+			f.msgs <- *held
+		}
+		f.pending.Wait()
+		close(f.msgs)
+		close(f.done)
+	}()
+
+	for {
+		msg, err := f.inner.Receive()
+		if err != nil {
+			if !errors.Is(err, ErrClosed) {
+				f.err = err
+			}
+			return
+		}
+		msg.Replier = f
+
+		ft := f.choose(f.rndIn)
+		if ft.drop {
+			log.Printf("[FAULT] Dropping request from %s", msg.Sender)
+			msg.Release()
+			continue
+		}
+		if ft.duplicate {
+			log.Printf("[FAULT] Duplicating request from %s", msg.Sender)
+			dup := msg
+			dup.Payload = append([]byte(nil), msg.Payload...)
+			dup.buf = nil
+			f.receive(dup, 0, false)
+		}
+		f.receive(msg, ft.delay, ft.reorder)
+	}
+}
+
+// receive delivers msg to Receive after delay, or after the next message if
+// reorder is set.
+func (f *Faulty) receive(msg Message, delay time.Duration, reorder bool) {
+	if delay > 0 {
+		log.Printf("[FAULT] Delaying request from %s by %s", msg.Sender, delay)
+		f.pending.Add(1)
+		time.AfterFunc(delay, func() {
+			defer f.pending.Done()
+			f.msgs <- msg
+		})
+		return
+	}
+
+	f.mu.Lock()
+	held := f.heldIn
+	f.heldIn = nil
+	if reorder && held == nil {
+		log.Printf("[FAULT] Holding back request from %s to reorder it", msg.Sender)
+		f.heldIn = &msg
+		f.mu.Unlock()
+		f.flushAfter(func() {
+			f.mu.Lock()
+			release := f.heldIn == &msg
+			if release {
+				f.heldIn = nil
+			}
+			f.mu.Unlock()
+			if release {
+				f.msgs <- msg
+			}
+		})
+		return
+	}
+	f.mu.Unlock()
+
+	f.msgs <- msg
+	if held != nil {
+		log.Printf("[FAULT] Delivering request from %s after one from %s", held.Sender, msg.Sender)
+		f.msgs <- *held
+	}
+}
+
+// flushAfter runs flush after the maximum delay, releasing a message held
+// back for reordering that no other message overtook.
+func (f *Faulty) flushAfter(flush func()) {
+	f.pending.Add(1)
+	time.AfterFunc(f.cfg.MaxDelay, func() {
+		defer f.pending.Done()
+		flush()
+	})
+}
+
+// Receive returns the next request that survived the faults.
+func (f *Faulty) Receive() (Message, error) {
+	msg, ok := <-f.msgs
+	if !ok {
+		if f.err != nil {
+			return Message{}, f.err
+		}
+		return Message{}, ErrClosed
+	}
+	return msg, nil
+}
+
+// Send sends data to addr through the inner transport, subject to faults.
+// A dropped message is reported as sent, as the network would.
+func (f *Faulty) Send(addr string, data []byte) error {
+	ft := f.choose(f.rndOut)
+	if ft.drop {
+		log.Printf("[FAULT] Dropping reply to %s", addr)
+		return nil
+	}
+	if ft.duplicate {
+		log.Printf("[FAULT] Duplicating reply to %s", addr)
+		if err := f.inner.Send(addr, data); err != nil {
+			return err
+		}
+	}
+	if ft.delay > 0 {
+		log.Printf("[FAULT] Delaying reply to %s by %s", addr, ft.delay)
+		data := append([]byte(nil), data...)
+		f.sending.Add(1)
+		time.AfterFunc(ft.delay, func() {
+			defer f.sending.Done()
+			if err := f.inner.Send(addr, data); err != nil {
+				log.Printf("[FAULT] Cannot send delayed reply to %s: %v", addr, err)
+			}
+		})
+		return nil
+	}
+
+	f.mu.Lock()
+	held := f.heldOut
+	f.heldOut = nil
+	if ft.reorder && held == nil {
+		log.Printf("[FAULT] Holding back reply to %s to reorder it", addr)
+		hs := &heldSend{addr: addr, data: append([]byte(nil), data...)}
+		f.heldOut = hs
+		f.mu.Unlock()
+		f.sending.Add(1)
+		time.AfterFunc(f.cfg.MaxDelay, func() {
+			defer f.sending.Done()
+			f.mu.Lock()
+			release := f.heldOut == hs
+			if release {
+				f.heldOut = nil
+			}
+			f.mu.Unlock()
+			if release {
+				f.sendHeld(hs)
+			}
+		})
+		return nil
+	}
+	f.mu.Unlock()
+
+	err := f.inner.Send(addr, data)
+	if held != nil {
+		log.Printf("[FAULT] Sending reply to %s after one to %s", held.addr, addr)
+		f.sendHeld(held)
+	}
+	return err
+}
+
+func (f *Faulty) sendHeld(hs *heldSend) {
+	if err := f.inner.Send(hs.addr, hs.data); err != nil {
+		log.Printf("[FAULT] Cannot send held back reply to %s: %v", hs.addr, err)
+	}
+}
+
+// MaxMessage returns the limit of the inner transport.
+func (f *Faulty) MaxMessage() int {
+	return f.inner.MaxMessage()
+}
+
+// Shutdown stops the inner transport receiving. Requests being delayed are
+// still delivered before Receive reports ErrClosed.
+func (f *Faulty) Shutdown(ctx context.Context) error {
+	if err := f.inner.Shutdown(ctx); err != nil {
+		return err
+	}
+	return waitDone(ctx, f.done)
+}
+
+// Close sends the replies being delayed, then closes the inner transport.
+func (f *Faulty) Close() error {
+	f.mu.Lock()
+	held := f.heldOut
+	f.heldOut = nil
+	f.mu.Unlock()
+	if held != nil {
+		f.sendHeld(held)
+	}
+	f.sending.Wait()
+	return f.inner.Close()
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Loopback is a Transport held entirely in memory. Clients attach with Dial
+// and exchange messages with the server without touching the network, which
+// makes it the transport to run the server in-process, from a tool or a
+// benchmark.
+type Loopback struct {
+	msgs chan Message
+	done chan struct{} // closed by Shutdown or Close; msgs is never closed
+
+	mu       sync.RWMutex
+	clients  map[string]*LoopbackClient
+	stopping bool
+	closed   bool
+}
+
+// LoopbackClient is a client attached to a Loopback.
+type LoopbackClient struct {
+	Name    string
+	server  *Loopback
+	replies chan []byte
+}
+
+func NewLoopback() *Loopback {
+	return &Loopback{
+		msgs:    make(chan Message, 10),
+		done:    make(chan struct{}),
+		clients: make(map[string]*LoopbackClient),
+	}
+}
+
+// Dial attaches a client that the server sees as sending from name.
+func (l *Loopback) Dial(name string) (*LoopbackClient, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := l.clients[name]; ok {
+		return nil, fmt.Errorf("loopback client %s already attached", name)
+	}
+	c := &LoopbackClient{Name: name, server: l, replies: make(chan []byte, 64)}
+	l.clients[name] = c
+	return c, nil
+}
+
+// Receive returns the next message sent by any client. Once the loopback is
+// shut down it returns the messages already queued, then ErrClosed.
+func (l *Loopback) Receive() (Message, error) {
+	select {
+	case msg := <-l.msgs:
+		return msg, nil
+	case <-l.done:
+	}
+	select {
+	case msg := <-l.msgs:
+		return msg, nil
+	default:
+		return Message{}, ErrClosed
+	}
+}
+
+// Send delivers a copy of data to the client attached as addr.
+func (l *Loopback) Send(addr string, data []byte) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	c, ok := l.clients[addr]
+	if !ok {
+		return fmt.Errorf("no loopback client %s", addr)
+	}
+	select {
+	case c.replies <- append([]byte(nil), data...):
+		return nil
+	default:
+		return fmt.Errorf("loopback client %s is not reading its replies", addr)
+	}
+}
+
+// MaxMessage returns 0: messages are never split in memory.
+func (l *Loopback) MaxMessage() int {
+	return 0
+}
+
+// Shutdown stops the server receiving; clients stay attached for replies
+// until Close.
+func (l *Loopback) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stop()
+	return nil
+}
+
+func (l *Loopback) stop() {
+	if !l.stopping {
+		l.stopping = true
+		close(l.done)
+	}
+}
+
+// Close stops the server receiving and detaches every client.
+func (l *Loopback) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	l.stop()
+	for name, c := range l.clients {
+		close(c.replies)
+		delete(l.clients, name)
+	}
+	return nil
+}
+
+// Send sends a copy of data to the server.
+func (c *LoopbackClient) Send(data []byte) error {
+	msg := Message{Sender: c.Name, Replier: c.server}
+	if len(data) <= bufferSize {
+		msg.buf = getBuffer()
+		msg.Payload = (*msg.buf)[:len(data)]
+	} else {
+		msg.Payload = make([]byte, len(data))
+	}
+	copy(msg.Payload, data)
+
+	// no lock is held while blocked on a full queue, which would stop
+	// Shutdown from ever taking it; done wakes the send up instead
+	select {
+	case <-c.server.done:
+		msg.Release()
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.server.msgs <- msg:
+		return nil
+	case <-c.server.done:
+		msg.Release()
+		return ErrClosed
+	}
+}
+
+// Receive returns the next reply or notification the server sent to c.
+func (c *LoopbackClient) Receive() ([]byte, error) {
+	reply, ok := <-c.replies
+	if !ok {
+		return nil, ErrClosed
+	}
+	return reply, nil
+}
+
+// Close detaches c from the server.
+func (c *LoopbackClient) Close() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if c.server.clients[c.Name] == c {
+		close(c.replies)
+		delete(c.server.clients, c.Name)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoopbackShutdownWhileSendBlocks(t *testing.T) {
+	l := NewLoopback()
+	defer l.Close()
+	c, err := l.Dial("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing receives, so the send after a full queue blocks
+	for i := 0; i < cap(l.msgs); i++ {
+		if err := c.Send([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- c.Send([]byte{0xff}) }()
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- l.Shutdown(context.Background()) }()
+	for _, ch := range []chan error{shutdown, sent} {
+		select {
+		case <-ch:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Shutdown deadlocked with a blocked Send")
+		}
+	}
+
+	// the queued messages are still delivered, then Receive reports the end
+	for i := 0; i < cap(l.msgs); i++ {
+		if _, err := l.Receive(); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if _, err := l.Receive(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive() after the queue drained: %v, want ErrClosed", err)
+	}
+	if err := c.Send([]byte{1}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send() after Shutdown: %v, want ErrClosed", err)
+	}
+}
@@ -1,54 +1,132 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"sync"
+	"time"
 )
 
-type Message struct {
-	Sender  string
-	Payload []byte
-}
+// MaxFrame is the largest message the TCP server accepts or sends.
+const MaxFrame = 1 << 20
+
+// DefaultIdleTimeout is how long a TCP connection may go without sending a
+// whole frame before it is closed, unless TCPServer.IdleTimeout says
+// otherwise.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// ErrFrameTooLarge is returned for a frame longer than MaxFrame.
+var ErrFrameTooLarge = errors.New("frame too large")
 
+// TCPServer serves clients that cannot use UDP. Each message travels as a
+// frame of
+//
+//	length uint32 | message
+//
+// with length big-endian and message exactly what would be one datagram over
+// UDP. A connection may carry any number of requests at once; replies come
+// back on it as they are ready, matched by request id.
 type TCPServer struct {
 	ListenAddr string
-	quitch     chan struct{}
-	MsgChannel chan Message
-	ln         net.Listener
+	// Network is "tcp" to listen on IPv4 and IPv6, or "tcp4" or "tcp6" for one
+	// of them only.
+	Network string
+	// IdleTimeout closes a connection that has not sent a whole frame for
+	// that long, so that clients that went away without closing do not hold
+	// a reader each forever.
+	IdleTimeout time.Duration
+	msgs        chan Message
+	ln          net.Listener
+	readers     sync.WaitGroup
+	closeOnce   sync.Once
+	done        chan struct{} // closed once every reader has returned
+	err         error         // why acceptConnections stopped, if not closed
+
+	mu       sync.Mutex
+	conns    map[string]*tcpConn
+	stopping bool
+}
+
+// tcpConn serializes the replies written to one connection.
+type tcpConn struct {
+	mu   sync.Mutex
+	conn net.Conn
 }
 
 func NewTCPServer(listenAddr string) *TCPServer {
 	return &TCPServer{
-		ListenAddr: listenAddr,
-		quitch:     make(chan struct{}),
-		MsgChannel: make(chan Message, 10),
+		ListenAddr:  listenAddr,
+		Network:     "tcp",
+		IdleTimeout: DefaultIdleTimeout,
+		msgs:        make(chan Message, 10),
+		conns:       make(map[string]*tcpConn),
+		done:        make(chan struct{}),
 	}
 }
 
+// Start binds the server's address and starts accepting connections.
 func (s *TCPServer) Start() error {
-	ln, err := net.Listen("tcp", s.ListenAddr)
+	ln, err := net.Listen(s.Network, s.ListenAddr)
 	if err != nil {
 		return err
 	}
-	defer ln.Close()
 	s.ln = ln
 
+	s.readers.Add(1)
 	go s.acceptConnections()
-
-	<-s.quitch
-	close(s.MsgChannel)
+	go func() {
+		s.readers.Wait()
+		close(s.msgs)
+		close(s.done)
+	}()
 
 	return nil
 }
 
 func (s *TCPServer) acceptConnections() {
+	defer s.readers.Done()
+	var delay time.Duration
 	for {
 		conn, err := s.ln.Accept()
 		if err != nil {
-			log.Fatal(err)
-			continue
+			if s.isStopping() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if temporary(err) {
+				delay = retryDelay(delay)
+				log.Printf("[TCP] Accept failed: %v; retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			// the listener is gone; drop the clients too, so that Receive
+			// reports the failure instead of waiting on them
+			log.Printf("[TCP] Accept failed: %v", err)
+			s.mu.Lock()
+			s.err = err
+			for _, c := range s.conns {
+				c.conn.Close()
+			}
+			s.mu.Unlock()
+			return
+		}
+		delay = 0
+
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			conn.Close()
+			return
 		}
+		s.conns[conn.RemoteAddr().String()] = &tcpConn{conn: conn}
+		s.readers.Add(1)
+		s.mu.Unlock()
 
 		fmt.Println("New connection received from:", conn.RemoteAddr())
 
@@ -57,21 +135,155 @@ func (s *TCPServer) acceptConnections() {
 }
 
 func (s *TCPServer) readIngress(conn net.Conn) {
-	defer conn.Close()
-	buf := make([]byte, 2048)
+	addr := conn.RemoteAddr().String()
+	defer s.readers.Done()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// once stopping, the connection stays open for the replies still
+		// to come and is closed by Close
+		if !s.stopping {
+			delete(s.conns, addr)
+			conn.Close()
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	var header [4]byte
 	for {
-		n, err := conn.Read(buf)
-		if err != nil {
-			log.Fatal(err)
-			continue
+		// Shutdown sets the deadline to now under the lock; never push it
+		// back once stopping
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		s.mu.Unlock()
+
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			switch {
+			case errors.Is(err, io.EOF):
+				fmt.Println("Connection closed by:", addr)
+			case s.isStopping() || errors.Is(err, net.ErrClosed):
+				// stopped by Shutdown or Close
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				log.Printf("[TCP] Closing connection from %s: idle for %s", addr, s.IdleTimeout)
+			default:
+				log.Printf("[TCP] Closing connection from %s: %v", addr, err)
+			}
+			return
+		}
+		length := binary.BigEndian.Uint32(header[:])
+		if length > MaxFrame {
+			log.Printf("[TCP] Closing connection from %s: %v: %d bytes", addr, ErrFrameTooLarge, length)
+			return
 		}
 
-		s.MsgChannel <- Message{
-			Sender:  conn.RemoteAddr().String(),
-			Payload: buf[:n],
+		msg := Message{Sender: addr, Replier: s}
+		if length <= bufferSize {
+			msg.buf = getBuffer()
+			msg.Payload = (*msg.buf)[:length]
+		} else {
+			msg.Payload = make([]byte, length)
+		}
+		if _, err := io.ReadFull(r, msg.Payload); err != nil {
+			if !s.isStopping() && !errors.Is(err, net.ErrClosed) {
+				log.Printf("[TCP] Closing connection from %s: %v", addr, err)
+			}
+			msg.Release()
+			return
 		}
 
-		conn.Write([]byte("Processing request\n"))
+		s.msgs <- msg
 	}
+}
 
+// Addr returns the address the server is bound to.
+func (s *TCPServer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Receive returns the next frame from any connection.
+func (s *TCPServer) Receive() (Message, error) {
+	msg, ok := <-s.msgs
+	if !ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return Message{}, s.err
+		}
+		return Message{}, ErrClosed
+	}
+	return msg, nil
+}
+
+// Send sends data as one frame on the connection from addr.
+func (s *TCPServer) Send(addr string, data []byte) error {
+	if len(data) > MaxFrame {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, len(data))
+	}
+
+	s.mu.Lock()
+	c, ok := s.conns[addr]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no connection from %s", addr)
+	}
+
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(frame, data...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// MaxMessage returns 0: frames need no fragmentation.
+func (s *TCPServer) MaxMessage() int {
+	return 0
+}
+
+func (s *TCPServer) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// Shutdown stops accepting connections and reading frames. Open connections
+// stay open for replies until Close.
+func (s *TCPServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopping = true
+	for _, c := range s.conns {
+		c.conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	if err := s.ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return waitDone(ctx, s.done)
+}
+
+// Close stops accepting connections and closes the open ones; frames already
+// received can still be read.
+func (s *TCPServer) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		if err = s.ln.Close(); errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.stopping = true
+		for addr, c := range s.conns {
+			c.conn.Close()
+			delete(s.conns, addr)
+		}
+	})
+	return err
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPIdleTimeout(t *testing.T) {
+	s := NewTCPServer("127.0.0.1:0")
+	s.IdleTimeout = 100 * time.Millisecond
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go func() {
+		for {
+			msg, err := s.Receive()
+			if err != nil {
+				return
+			}
+			msg.Release()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a client sending frames more often than the timeout stays connected
+	frame := binary.BigEndian.AppendUint32(nil, 1)
+	frame = append(frame, 0)
+	for i := 0; i < 4; i++ {
+		if _, err := conn.Write(frame); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		time.Sleep(s.IdleTimeout / 2)
+	}
+
+	// then is disconnected once it goes quiet
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() from an idle connection: %v, want EOF", err)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by Receive once a transport has been closed.
+var ErrClosed = errors.New("transport closed")
+
+// Backoff after a read error the network may recover from, as net/http does
+// for Accept.
+const (
+	minRetryDelay = 5 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// Message is one datagram, or one frame from a TCP connection. Payload is
+// owned by the receiver until it calls Release. Replier is the reply handle:
+// replies go back through it, to Sender or to any other peer of the same
+// transport.
+type Message struct {
+	Sender  string
+	Payload []byte
+	Replier Replier
+	buf     *[]byte
+}
+
+// Replier sends messages to the peers of a transport.
+type Replier interface {
+	// Send sends data to the peer at addr.
+	Send(addr string, data []byte) error
+	// MaxMessage is the largest message Send delivers in one piece, or 0 if
+	// any message fits; larger ones must be fragmented first.
+	MaxMessage() int
+}
+
+// Transport carries requests in and replies and notifications out, so that
+// nothing above it needs to know whether it runs over UDP, TCP or memory.
+type Transport interface {
+	Replier
+	// Receive blocks until a message arrives, and returns ErrClosed once the
+	// transport is closed, or the error that stopped it receiving for good.
+	Receive() (Message, error)
+	// Shutdown stops reading from the network and returns once nothing more
+	// will be received, or ctx is done. Receive still returns the messages
+	// already received before ErrClosed, and Send keeps working, so that
+	// they can be answered.
+	Shutdown(ctx context.Context) error
+	// Close stops receiving and releases the transport's resources.
+	Close() error
+}
+
+// waitDone waits until done is closed or ctx is done.
+func waitDone(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// temporary reports whether a read that failed with err is worth retrying,
+// such as an Accept that ran out of file descriptors.
+func temporary(err error) bool {
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// retryDelay returns how long to wait before retrying a read that failed
+// again after delay, starting from minRetryDelay.
+func retryDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return minRetryDelay
+	}
+	if delay *= 2; delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -1,69 +1,142 @@
 package server
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goflysys/pkg/fragment"
 )
 
+// UDPServer is the Transport clients use by default: one message per
+// datagram.
 type UDPServer struct {
 	ListenAddr string
-	quitch     chan struct{}
-	MsgChannel chan Message
-	Ln         net.UDPConn
+	// Network is "udp" to listen on IPv4 and IPv6, or "udp4" or "udp6" for one
+	// of them only.
+	Network   string
+	msgs      chan Message
+	ln        *net.UDPConn
+	closeOnce sync.Once
+	stopping  atomic.Bool
+	done      chan struct{} // closed once readIngress returns
+	err       error         // why readIngress stopped, if not closed
 }
 
 func NewUDPServer(listenAddr string) *UDPServer {
 	return &UDPServer{
 		ListenAddr: listenAddr,
-		quitch:     make(chan struct{}),
-		MsgChannel: make(chan Message, 10),
+		Network:    "udp",
+		msgs:       make(chan Message, 10),
+		done:       make(chan struct{}),
 	}
 }
 
+// Start binds the server's address and starts receiving datagrams.
 func (s *UDPServer) Start() error {
-	laddr, err := net.ResolveUDPAddr("udp", s.ListenAddr)
+	laddr, err := net.ResolveUDPAddr(s.Network, s.ListenAddr)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	ln, err := net.ListenUDP("udp", laddr)
+	ln, err := net.ListenUDP(s.Network, laddr)
 	if err != nil {
 		return err
 	}
+	s.ln = ln
 
-	defer ln.Close()
-	s.Ln = *ln
-
-	go s.readIngress(*ln)
-
-	<-s.quitch
-	close(s.MsgChannel)
+	go s.readIngress()
 
 	return nil
 }
 
-func (s *UDPServer) readIngress(conn net.UDPConn) {
-	defer conn.Close()
-	buf := make([]byte, 2048)
+func (s *UDPServer) readIngress() {
+	defer close(s.done)
+	defer close(s.msgs)
+	var delay time.Duration
 	for {
-		n, addr, err := conn.ReadFromUDP(buf)
+		// every datagram gets its own buffer, since the previous one may
+		// still be queued or being handled
+		buf := getBuffer()
+		n, addr, err := s.ln.ReadFromUDP(*buf)
 		if err != nil {
-			log.Fatal((err))
-			continue
+			buffers.Put(buf)
+			if s.stopping.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if temporary(err) {
+				delay = retryDelay(delay)
+				log.Printf("[UDP] Receive failed: %v; retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			log.Printf("[UDP] Receive failed: %v", err)
+			s.err = err
+			return
 		}
+		delay = 0
 
-		s.MsgChannel <- Message{
+		s.msgs <- Message{
 			Sender:  addr.String(),
-			Payload: buf[:n],
+			Payload: (*buf)[:n],
+			Replier: s,
+			buf:     buf,
 		}
+	}
+}
 
-		fmt.Println("New connection received from:", addr)
+// Addr returns the address the server is bound to.
+func (s *UDPServer) Addr() net.Addr {
+	return s.ln.LocalAddr()
+}
 
-		// _, err = conn.WriteToUDP([]byte("Processing request\n"), addr)
-		if err != nil {
-			log.Fatal(err)
-			continue
+// Receive returns the next datagram.
+func (s *UDPServer) Receive() (Message, error) {
+	msg, ok := <-s.msgs
+	if !ok {
+		if s.err != nil {
+			return Message{}, s.err
 		}
+		return Message{}, ErrClosed
 	}
+	return msg, nil
+}
+
+// Send sends data as one datagram to addr.
+func (s *UDPServer) Send(addr string, data []byte) error {
+	sendAddr, err := net.ResolveUDPAddr(s.Network, addr)
+	if err != nil {
+		return err
+	}
+	_, err = s.ln.WriteToUDP(data, sendAddr)
+	return err
+}
+
+// MaxMessage returns the largest datagram that crosses a 1500-byte MTU
+// unfragmented.
+func (s *UDPServer) MaxMessage() int {
+	return fragment.MaxDatagram
+}
+
+// Shutdown stops reading datagrams. The socket stays open for replies until
+// Close.
+func (s *UDPServer) Shutdown(ctx context.Context) error {
+	s.stopping.Store(true)
+	if err := s.ln.SetReadDeadline(time.Now()); err != nil {
+		return err
+	}
+	return waitDone(ctx, s.done)
+}
+
+// Close closes the socket; datagrams already received can still be read.
+func (s *UDPServer) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.ln.Close()
+	})
+	return err
 }
@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"encoding/binary"
+
+	"goflysys/pkg/marshal"
+)
+
+// CDRMessage is implemented by the types generated from an IDL file, which the
+// CDR codecs encode without reflection. Other values go through
+// marshal.Encoder.Encode and marshal.Decoder.Decode.
+type CDRMessage interface {
+	Encode(e *marshal.Encoder)
+	Decode(d *marshal.Decoder) error
+}
+
+var (
+	// CDR is the plain pkg/marshal representation.
+	CDR Codec = cdrCodec{}
+	// OMGCDR is the OMG CDR encapsulation, big-endian when encoding. Bodies
+	// decoded with it answer in the byte order of the sender.
+	OMGCDR Codec = cdrCodec{omg: true, order: binary.BigEndian}
+)
+
+type cdrCodec struct {
+	omg   bool
+	order binary.ByteOrder
+}
+
+func (c cdrCodec) Name() string {
+	if c.omg {
+		return "omg-cdr"
+	}
+	return "cdr"
+}
+
+func (c cdrCodec) Flags() marshal.Flags {
+	if c.omg {
+		return marshal.CodecCDR | marshal.FlagCDR
+	}
+	return marshal.CodecCDR
+}
+
+func (c cdrCodec) Decode(t marshal.MessageType, body []byte) (*Body, error) {
+	d := marshal.NewDecoder(body)
+	if c.omg {
+		var err error
+		if d, err = marshal.NewCDRDecoder(body); err != nil {
+			return nil, err
+		}
+		c.order = d.ByteOrder()
+	}
+
+	b := &Body{codec: c}
+	var err error
+	if t != marshal.MessageNotification {
+		if b.ID, err = d.ReadUint32(); err != nil {
+			return nil, err
+		}
+	}
+	if b.Code, err = d.ReadUint32(); err != nil {
+		return nil, err
+	}
+
+	b.present = d.Remaining() > 0
+	b.payload = func(v any) error {
+		if m, ok := v.(CDRMessage); ok {
+			err = m.Decode(d)
+		} else {
+			err = d.Decode(v)
+		}
+		if err != nil {
+			return err
+		}
+		return d.Finish()
+	}
+
+	return b, nil
+}
+
+func (c cdrCodec) Encode(t marshal.MessageType, id, code uint32, payload any) ([]byte, error) {
+	e := marshal.NewEncoder(nil)
+	if c.omg {
+		e = marshal.NewCDREncoder(nil, c.order)
+	}
+
+	if t != marshal.MessageNotification {
+		e.WriteUint32(id)
+	}
+	e.WriteUint32(code)
+
+	if m, ok := payload.(CDRMessage); ok {
+		m.Encode(e)
+	} else if payload != nil {
+		if err := e.Encode(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+// Package codec encodes and decodes message bodies in the representations a
+// client can choose per request with the codec bits of the envelope flags:
+//
+//	marshal.CodecCDR     the pkg/marshal representation, OMG CDR if marshal.FlagCDR is also set
+//	marshal.CodecJSON    JSON, convenient for debugging with netcat
+//	marshal.CodecMsgPack MessagePack, for compact clients
+//
+// Every codec carries the same three bodies: a request is a request id, a
+// selector and args; a reply is a request id, a status and an optional
+// result; a notification is a selector and fields. The payload is decoded
+// into a Go value only once the caller knows its type from the selector, so
+// handlers work on the same typed values whichever codec the client used.
+package codec
+
+import (
+	"errors"
+	"fmt"
+
+	"goflysys/pkg/marshal"
+)
+
+// ErrUnknownCodec is returned by ForFlags for codec bits no codec is
+// registered for.
+var ErrUnknownCodec = errors.New("codec: unknown codec")
+
+// Codec reads and writes message bodies in one representation.
+type Codec interface {
+	// Name identifies the codec in logs.
+	Name() string
+	// Flags returns the envelope flags that select the codec.
+	Flags() marshal.Flags
+	// Decode reads the header of a body of type t. The payload is left for
+	// Body.DecodePayload.
+	Decode(t marshal.MessageType, body []byte) (*Body, error)
+	// Encode returns a body of type t. id is ignored for notifications and
+	// a nil payload is omitted, as in a reply without a result.
+	Encode(t marshal.MessageType, id, code uint32, payload any) ([]byte, error)
+}
+
+// Body is a decoded message body.
+type Body struct {
+	ID   uint32 // request id of requests and replies
+	Code uint32 // selector of requests and notifications, status of replies
+
+	codec   Codec
+	present bool
+	payload func(v any) error
+}
+
+// Codec returns the codec the body was decoded with, configured so the bodies
+// it encodes mirror this one; replies use it to answer in the representation
+// of their request.
+func (b *Body) Codec() Codec {
+	return b.codec
+}
+
+// HasPayload reports whether the body carries args, a result or fields,
+// telling a reply without a result apart from one with an empty result.
+func (b *Body) HasPayload() bool {
+	return b.present
+}
+
+// DecodePayload decodes the args, result or fields of the body into the value
+// v points to. The payload must be consumed entirely.
+func (b *Body) DecodePayload(v any) error {
+	return b.payload(v)
+}
+
+// ForFlags returns the codec selected by the envelope flags.
+func ForFlags(flags marshal.Flags) (Codec, error) {
+	switch flags & marshal.CodecMask {
+	case marshal.CodecCDR:
+		if flags&marshal.FlagCDR != 0 {
+			return OMGCDR, nil
+		}
+		return CDR, nil
+	case marshal.CodecJSON:
+		if flags&marshal.FlagCDR != 0 {
+			return nil, fmt.Errorf("%w: FlagCDR with JSON", ErrUnknownCodec)
+		}
+		return JSON, nil
+	case marshal.CodecMsgPack:
+		if flags&marshal.FlagCDR != 0 {
+			return nil, fmt.Errorf("%w: FlagCDR with MessagePack", ErrUnknownCodec)
+		}
+		return MsgPack, nil
+	default:
+		return nil, fmt.Errorf("%w: %#x", ErrUnknownCodec, uint16(flags&marshal.CodecMask))
+	}
+}
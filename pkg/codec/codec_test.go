@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"goflysys/pkg/marshal"
+)
+
+type seats struct {
+	ID       uint32   `json:"id"`
+	Name     string   `json:"name"`
+	Price    float64  `json:"price"`
+	Held     []uint32 `json:"held"`
+	Window   bool     `json:"window"`
+	Boarding []byte   `json:"boarding"`
+}
+
+var codecs = []Codec{CDR, OMGCDR, JSON, MsgPack}
+
+func TestRoundTrip(t *testing.T) {
+	want := seats{ID: 7, Name: "CDG-HND", Price: 99.5, Held: []uint32{1, 2}, Window: true, Boarding: []byte{0, 1, 2}}
+	for _, c := range codecs {
+		for _, typ := range []marshal.MessageType{marshal.MessageRequest, marshal.MessageReply, marshal.MessageNotification} {
+			body, err := c.Encode(typ, 3, 4, want)
+			if err != nil {
+				t.Fatalf("%s: Encode: %v", c.Name(), err)
+			}
+			b, err := c.Decode(typ, body)
+			if err != nil {
+				t.Fatalf("%s: Decode: %v", c.Name(), err)
+			}
+			if typ != marshal.MessageNotification && b.ID != 3 {
+				t.Errorf("%s: ID %d, want 3", c.Name(), b.ID)
+			}
+			if b.Code != 4 || !b.HasPayload() {
+				t.Errorf("%s: Code %d, HasPayload %v; want 4, true", c.Name(), b.Code, b.HasPayload())
+			}
+			var got seats
+			if err := b.DecodePayload(&got); err != nil {
+				t.Fatalf("%s: DecodePayload: %v", c.Name(), err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %+v, want %+v", c.Name(), got, want)
+			}
+			if b.Codec().Flags() != c.Flags() {
+				t.Errorf("%s: decoded body answers with flags %#x", c.Name(), b.Codec().Flags())
+			}
+		}
+	}
+}
+
+func TestReplyWithoutResult(t *testing.T) {
+	for _, c := range codecs {
+		body, err := c.Encode(marshal.MessageReply, 1, 404, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		b, err := c.Decode(marshal.MessageReply, body)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		if b.ID != 1 || b.Code != 404 || b.HasPayload() {
+			t.Errorf("%s: got %d, %d, HasPayload %v", c.Name(), b.ID, b.Code, b.HasPayload())
+		}
+	}
+}
+
+func TestForFlags(t *testing.T) {
+	for _, c := range codecs {
+		got, err := ForFlags(c.Flags() | marshal.FlagChecksum)
+		if err != nil || got != c {
+			t.Errorf("ForFlags(%#x) = %v, %v; want %s", c.Flags(), got, err, c.Name())
+		}
+	}
+	for _, flags := range []marshal.Flags{
+		marshal.CodecJSON | marshal.FlagCDR,
+		marshal.CodecMsgPack | marshal.FlagCDR,
+		marshal.CodecMask,
+	} {
+		if c, err := ForFlags(flags); !errors.Is(err, ErrUnknownCodec) {
+			t.Errorf("ForFlags(%#x) = %v, %v; want ErrUnknownCodec", flags, c, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"goflysys/pkg/marshal"
+)
+
+// JSON encodes bodies as JSON objects, for example
+//
+//	{"reqId":1,"selector":2,"args":{"id":7}}
+//	{"reqId":1,"status":200,"result":{"departureTime":1700000000,"price":99.5,"seatsLeft":3}}
+//
+// Octets are base64 strings and times RFC 3339 strings, as encoding/json
+// writes them.
+var JSON Codec = &structuredCodec[json.RawMessage]{
+	name:      "json",
+	flags:     marshal.CodecJSON,
+	marshal:   json.Marshal,
+	unmarshal: unmarshalJSON,
+}
+
+func unmarshalJSON(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("codec: trailing data after JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"goflysys/pkg/marshal"
+)
+
+// MsgPack encodes bodies as MessagePack maps with the same keys as JSON,
+// integers in their most compact form. Octets are bin values and times use
+// the MessagePack timestamp extension.
+var MsgPack Codec = &structuredCodec[msgpack.RawMessage]{
+	name:      "msgpack",
+	flags:     marshal.CodecMsgPack,
+	marshal:   marshalMsgPack,
+	unmarshal: unmarshalMsgPack,
+}
+
+func marshalMsgPack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	e := msgpack.NewEncoder(&buf)
+	e.SetCustomStructTag("json")
+	e.UseCompactInts(true)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalMsgPack(data []byte, v any) error {
+	r := bytes.NewReader(data)
+	d := msgpack.NewDecoder(r)
+	d.SetCustomStructTag("json")
+	d.DisallowUnknownFields(true)
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("codec: trailing data after MessagePack value")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"goflysys/pkg/marshal"
+)
+
+// The self-describing codecs carry each body as an object with named fields.
+// P is the payload: the value being encoded, or the codec's raw message type
+// while decoding so the payload can wait for DecodePayload.
+type requestBody[P any] struct {
+	ReqId    uint32 `json:"reqId" msgpack:"reqId"`
+	Selector uint32 `json:"selector" msgpack:"selector"`
+	Args     P      `json:"args,omitempty" msgpack:"args,omitempty"`
+}
+
+type replyBody[P any] struct {
+	ReqId  uint32 `json:"reqId" msgpack:"reqId"`
+	Status uint32 `json:"status" msgpack:"status"`
+	Result P      `json:"result,omitempty" msgpack:"result,omitempty"`
+}
+
+type notificationBody[P any] struct {
+	Selector uint32 `json:"selector" msgpack:"selector"`
+	Fields   P      `json:"fields,omitempty" msgpack:"fields,omitempty"`
+}
+
+// structuredCodec implements Codec on top of a marshal/unmarshal pair that
+// uses the json struct tags of the generated types. R is the raw message type
+// of the encoding.
+type structuredCodec[R ~[]byte] struct {
+	name      string
+	flags     marshal.Flags
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error // strict: no unknown fields or trailing data
+}
+
+func (c *structuredCodec[R]) Name() string {
+	return c.name
+}
+
+func (c *structuredCodec[R]) Flags() marshal.Flags {
+	return c.flags
+}
+
+func (c *structuredCodec[R]) Decode(t marshal.MessageType, body []byte) (*Body, error) {
+	b := &Body{codec: c}
+	var raw R
+	switch t {
+	case marshal.MessageRequest:
+		var m requestBody[R]
+		if err := c.unmarshal(body, &m); err != nil {
+			return nil, err
+		}
+		b.ID, b.Code, raw = m.ReqId, m.Selector, m.Args
+	case marshal.MessageReply:
+		var m replyBody[R]
+		if err := c.unmarshal(body, &m); err != nil {
+			return nil, err
+		}
+		b.ID, b.Code, raw = m.ReqId, m.Status, m.Result
+	default:
+		var m notificationBody[R]
+		if err := c.unmarshal(body, &m); err != nil {
+			return nil, err
+		}
+		b.Code, raw = m.Selector, m.Fields
+	}
+
+	b.present = len(raw) > 0
+	b.payload = func(v any) error {
+		if len(raw) == 0 {
+			return nil // absent, every field keeps its zero value
+		}
+		return c.unmarshal(raw, v)
+	}
+
+	return b, nil
+}
+
+func (c *structuredCodec[R]) Encode(t marshal.MessageType, id, code uint32, payload any) ([]byte, error) {
+	switch t {
+	case marshal.MessageRequest:
+		return c.marshal(requestBody[any]{ReqId: id, Selector: code, Args: payload})
+	case marshal.MessageReply:
+		return c.marshal(replyBody[any]{ReqId: id, Status: code, Result: payload})
+	default:
+		return c.marshal(notificationBody[any]{Selector: code, Fields: payload})
+	}
+}
@@ -0,0 +1,285 @@
+// Package fragment splits sealed messages that do not fit in one datagram and
+// reassembles them on the receiving side.
+//
+// A fragment is itself a message: an envelope with marshal.FlagFragment and
+// marshal.FlagChecksum set, whose body is
+//
+//	messageId uint32 | index uint16 | count uint16 | chunk
+//
+// Concatenating the chunks of fragments 0..count-1 gives back the original
+// sealed message, which is then opened as usual. Senders use the request id
+// as the message id, so a reply replayed from the response cache carries the
+// same fragments as the original and can fill in any that were lost.
+package fragment
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+const (
+	// MaxDatagram is the largest datagram Split produces, chosen to fit in a
+	// 1500-byte Ethernet MTU after IP and UDP headers.
+	MaxDatagram = 1400
+	// MaxFragments bounds how many fragments one message may be split into.
+	MaxFragments = 1024
+
+	headerLen   = 8
+	overheadLen = marshal.EnvelopeLen + headerLen + 4 // envelope, fragment header, checksum
+)
+
+var (
+	// ErrTooLarge is returned by Split when a message needs more than MaxFragments.
+	ErrTooLarge = errors.New("fragment: message too large")
+	// ErrInvalidFragment is returned by Add for fragments with an impossible header.
+	ErrInvalidFragment = errors.New("fragment: invalid fragment")
+)
+
+// Split returns msg as a list of datagrams no larger than maxDatagram. A
+// message that already fits is returned unchanged as the only datagram.
+func Split(msg []byte, messageId uint32, maxDatagram int) ([][]byte, error) {
+	if len(msg) <= maxDatagram {
+		return [][]byte{msg}, nil
+	}
+	if maxDatagram <= overheadLen {
+		return nil, fmt.Errorf("fragment: datagram size %d leaves no room for data", maxDatagram)
+	}
+
+	env, _, err := marshal.Open(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkLen := maxDatagram - overheadLen
+	count := (len(msg) + chunkLen - 1) / chunkLen
+	if count > MaxFragments {
+		return nil, fmt.Errorf("%w: %d bytes need %d fragments", ErrTooLarge, len(msg), count)
+	}
+
+	fragEnvelope := marshal.NewEnvelope(env.Type, marshal.FlagFragment|marshal.FlagChecksum)
+	datagrams := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := msg[i*chunkLen : min(len(msg), (i+1)*chunkLen)]
+
+		body := make([]byte, headerLen, headerLen+len(chunk))
+		binary.BigEndian.PutUint32(body[0:4], messageId)
+		binary.BigEndian.PutUint16(body[4:6], uint16(i))
+		binary.BigEndian.PutUint16(body[6:8], uint16(count))
+		body = append(body, chunk...)
+
+		datagrams = append(datagrams, fragEnvelope.Seal(body))
+	}
+
+	return datagrams, nil
+}
+
+// Default limits of a Reassembler, which bound the memory a sender can make
+// it hold with fragments of messages it never completes.
+const (
+	DefaultMaxPerSource = 16
+	DefaultMaxPartials  = 4096
+	DefaultMaxBytes     = 64 << 20
+)
+
+type key struct {
+	source    string
+	messageId uint32
+}
+
+type partial struct {
+	key      key
+	chunks   [][]byte
+	received int
+	size     int // bytes in chunks
+	started  time.Time
+	elem     *list.Element
+}
+
+// Reassembler collects fragments per source and message id until every
+// fragment of a message has arrived. Incomplete messages are discarded once
+// they are older than the timeout, or oldest first once a source or the
+// reassembler as a whole holds too many.
+type Reassembler struct {
+	// MaxPerSource caps the incomplete messages from one source.
+	MaxPerSource int
+	// MaxPartials caps the incomplete messages from all sources.
+	MaxPartials int
+	// MaxBytes caps the fragments held for incomplete messages.
+	MaxBytes int
+
+	timeout  time.Duration
+	mu       sync.Mutex
+	partials map[key]*partial
+	order    *list.List // of *partial, oldest first
+	sources  map[string]int
+	size     int
+	expired  uint64
+	done     chan struct{}
+	closed   sync.Once
+}
+
+// NewReassembler returns a Reassembler discarding incomplete messages after
+// timeout. It sweeps them on a timer until Close.
+func NewReassembler(timeout time.Duration) *Reassembler {
+	r := &Reassembler{
+		MaxPerSource: DefaultMaxPerSource,
+		MaxPartials:  DefaultMaxPartials,
+		MaxBytes:     DefaultMaxBytes,
+		timeout:      timeout,
+		partials:     make(map[key]*partial),
+		order:        list.New(),
+		sources:      make(map[string]int),
+		done:         make(chan struct{}),
+	}
+	go r.sweepEvery(timeout / 2)
+	return r
+}
+
+// Add takes one received datagram. Datagrams that are not fragments are
+// returned unchanged. For fragments Add returns the reassembled message once
+// the last missing fragment arrives and nil until then.
+func (r *Reassembler) Add(source string, datagram []byte) ([]byte, error) {
+	env, body, err := marshal.Open(datagram)
+	if err != nil {
+		return nil, err
+	}
+	if env.Flags&marshal.FlagFragment == 0 {
+		return datagram, nil
+	}
+	if len(body) < headerLen {
+		return nil, fmt.Errorf("%w: need %d header bytes, have %d", ErrInvalidFragment, headerLen, len(body))
+	}
+
+	messageId := binary.BigEndian.Uint32(body[0:4])
+	index := int(binary.BigEndian.Uint16(body[4:6]))
+	count := int(binary.BigEndian.Uint16(body[6:8]))
+	if count == 0 || count > MaxFragments || index >= count {
+		return nil, fmt.Errorf("%w: fragment %d of %d", ErrInvalidFragment, index, count)
+	}
+	chunk := body[headerLen:]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := key{source: source, messageId: messageId}
+	p, ok := r.partials[k]
+	if ok && len(p.chunks) != count {
+		// the id was reused for a different message; start over
+		r.remove(p)
+		ok = false
+	}
+	if !ok {
+		r.makeRoom(source)
+		p = &partial{key: k, chunks: make([][]byte, count), started: time.Now()}
+		p.elem = r.order.PushBack(p)
+		r.partials[k] = p
+		r.sources[source]++
+	}
+	if p.chunks[index] == nil {
+		for r.MaxBytes > 0 && r.size+len(chunk) > r.MaxBytes && r.order.Front().Value != p {
+			r.drop(r.order.Front().Value.(*partial))
+		}
+		p.chunks[index] = append([]byte(nil), chunk...)
+		p.received++
+		p.size += len(chunk)
+		r.size += len(chunk)
+	}
+	if p.received < count {
+		return nil, nil
+	}
+
+	r.remove(p)
+	msg := make([]byte, 0, p.size)
+	for _, chunk := range p.chunks {
+		msg = append(msg, chunk...)
+	}
+
+	return msg, nil
+}
+
+// makeRoom discards the oldest incomplete messages until a new one from
+// source fits within MaxPerSource and MaxPartials.
+func (r *Reassembler) makeRoom(source string) {
+	if r.MaxPerSource > 0 && r.sources[source] >= r.MaxPerSource {
+		for e := r.order.Front(); e != nil; e = e.Next() {
+			if p := e.Value.(*partial); p.key.source == source {
+				r.drop(p)
+				break
+			}
+		}
+	}
+	for r.MaxPartials > 0 && len(r.partials) >= r.MaxPartials {
+		r.drop(r.order.Front().Value.(*partial))
+	}
+}
+
+// drop discards an incomplete message.
+func (r *Reassembler) drop(p *partial) {
+	r.remove(p)
+	r.expired++
+}
+
+func (r *Reassembler) remove(p *partial) {
+	delete(r.partials, p.key)
+	r.order.Remove(p.elem)
+	if r.sources[p.key.source]--; r.sources[p.key.source] == 0 {
+		delete(r.sources, p.key.source)
+	}
+	r.size -= p.size
+}
+
+// Expired returns how many incomplete messages have been discarded.
+func (r *Reassembler) Expired() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.expired
+}
+
+// Close stops sweeping incomplete messages on a timer.
+func (r *Reassembler) Close() {
+	r.closed.Do(func() { close(r.done) })
+}
+
+func (r *Reassembler) sweepEvery(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.mu.Lock()
+			r.sweep(now)
+			r.mu.Unlock()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// sweep discards the incomplete messages older than the timeout.
+func (r *Reassembler) sweep(now time.Time) {
+	for e := r.order.Front(); e != nil; {
+		p := e.Value.(*partial)
+		if now.Sub(p.started) <= r.timeout {
+			break // the rest are younger
+		}
+		e = e.Next()
+		r.drop(p)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+package fragment
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+// fragments returns the datagrams of a message of n bytes split with
+// messageId.
+func fragments(t *testing.T, messageId uint32, n int) (msg []byte, datagrams [][]byte) {
+	t.Helper()
+	msg = marshal.NewEnvelope(marshal.MessageRequest, marshal.FlagChecksum).Seal(bytes.Repeat([]byte{byte(messageId)}, n))
+	datagrams, err := Split(msg, messageId, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datagrams) < 2 {
+		t.Fatalf("message of %d bytes was not split", n)
+	}
+	return msg, datagrams
+}
+
+// held returns how many incomplete messages r holds.
+func held(r *Reassembler) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.partials)
+}
+
+func TestReassemble(t *testing.T) {
+	r := NewReassembler(time.Minute)
+	defer r.Close()
+	msg, datagrams := fragments(t, 1, 500)
+
+	// fragments may arrive in any order and more than once
+	for i := len(datagrams) - 1; i > 0; i-- {
+		for copies := 0; copies < 2; copies++ {
+			if got, err := r.Add("a", datagrams[i]); got != nil || err != nil {
+				t.Fatalf("fragment %d: got %d bytes, %v before the last fragment", i, len(got), err)
+			}
+		}
+	}
+	got, err := r.Add("a", datagrams[0])
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("got %d bytes, %v; want the %d-byte message", len(got), err, len(msg))
+	}
+	if n := held(r); n != 0 {
+		t.Errorf("holds %d incomplete messages after reassembly", n)
+	}
+}
+
+func TestMaxPerSourceDropsOldest(t *testing.T) {
+	r := NewReassembler(time.Minute)
+	defer r.Close()
+	r.MaxPerSource = 2
+
+	_, first := fragments(t, 1, 300)
+	for id := uint32(1); id <= 3; id++ {
+		_, datagrams := fragments(t, id, 300)
+		r.Add("flooder", datagrams[0])
+	}
+	if n := held(r); n != 2 {
+		t.Errorf("holds %d incomplete messages, want 2", n)
+	}
+	if n := r.Expired(); n != 1 {
+		t.Errorf("Expired() = %d, want 1", n)
+	}
+
+	// the other sources keep their messages
+	msg, datagrams := fragments(t, 1, 300)
+	r.Add("other", datagrams[0])
+	for _, d := range datagrams[1 : len(datagrams)-1] {
+		r.Add("other", d)
+	}
+	if got, _ := r.Add("other", datagrams[len(datagrams)-1]); !bytes.Equal(got, msg) {
+		t.Errorf("message of another source was dropped")
+	}
+
+	// message 1 of the flooder was dropped, so its rest starts over
+	for _, d := range first[1:] {
+		if got, _ := r.Add("flooder", d); got != nil {
+			t.Error("message reassembled from the fragments of a dropped one")
+		}
+	}
+}
+
+func TestMaxPartialsDropsOldest(t *testing.T) {
+	r := NewReassembler(time.Minute)
+	defer r.Close()
+	r.MaxPartials = 3
+
+	for id := uint32(1); id <= 5; id++ {
+		_, datagrams := fragments(t, id, 300)
+		r.Add(string(rune('a'+id)), datagrams[0])
+	}
+	if n := held(r); n != 3 {
+		t.Errorf("holds %d incomplete messages, want 3", n)
+	}
+	if n := r.Expired(); n != 2 {
+		t.Errorf("Expired() = %d, want 2", n)
+	}
+}
+
+func TestMaxBytesDropsOldest(t *testing.T) {
+	r := NewReassembler(time.Minute)
+	defer r.Close()
+
+	_, datagrams := fragments(t, 1, 300)
+	chunk := len(datagrams[0]) - overheadLen
+	r.MaxBytes = 2 * chunk
+	for id := uint32(1); id <= 3; id++ {
+		_, datagrams := fragments(t, id, 300)
+		r.Add("a", datagrams[0])
+	}
+	r.mu.Lock()
+	size := r.size
+	r.mu.Unlock()
+	if size > r.MaxBytes {
+		t.Errorf("holds %d bytes of fragments, want at most %d", size, r.MaxBytes)
+	}
+	if n := held(r); n != 2 {
+		t.Errorf("holds %d incomplete messages, want 2", n)
+	}
+}
+
+func TestSweepOnTimer(t *testing.T) {
+	r := NewReassembler(50 * time.Millisecond)
+	defer r.Close()
+	_, datagrams := fragments(t, 1, 300)
+	r.Add("a", datagrams[0])
+
+	// nothing else is added, so only the timer can discard the message
+	deadline := time.Now().Add(2 * time.Second)
+	for held(r) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("incomplete message not discarded after its timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := r.Expired(); n != 1 {
+		t.Errorf("Expired() = %d, want 1", n)
+	}
+}
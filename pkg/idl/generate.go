@@ -0,0 +1,244 @@
+package idl
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"unicode"
+)
+
+// Generate emits the Go source for f into package pkg. The generated code
+// expects the package to provide FlightsRouter, FlightDatabase, Client,
+// Operation, Notification, HTTPRoute and malformedRequest, as internal/api
+// does.
+func Generate(f *File, pkg string, source string) ([]byte, error) {
+	g := &generator{}
+
+	g.printf("// Code generated by gfsidl from %s. DO NOT EDIT.\n\n", source)
+	g.printf("package %s\n\n", pkg)
+	if f.usesTime() {
+		g.printf("import (\n\"time\"\n\n\"goflysys/pkg/codec\"\n\"goflysys/pkg/marshal\"\n)\n\n")
+	} else {
+		g.printf("import (\n\"goflysys/pkg/codec\"\n\"goflysys/pkg/marshal\"\n)\n\n")
+	}
+
+	g.printf("// Status codes sent after the request id of every reply.\nconst (\n")
+	for _, s := range f.Statuses {
+		g.printf("Status%s uint32 = %d\n", s.Name, s.Code)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// Function selectors of every operation and notification.\nconst (\n")
+	for _, op := range f.Operations {
+		g.printf("Selector%s uint32 = %d\n", op.Name, op.Selector)
+	}
+	for _, n := range f.Notifications {
+		g.printf("Selector%s uint32 = %d\n", n.Name, n.Selector)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// StatusText maps each status code to its name in %s.\n", source)
+	g.printf("var StatusText = map[uint32]string{\n")
+	for _, s := range f.Statuses {
+		g.printf("Status%s: %q,\n", s.Name, s.Name)
+	}
+	g.printf("}\n\n")
+
+	for _, op := range f.Operations {
+		g.message(op.Name+"Args", fmt.Sprintf("arguments of %s", op.Name), op.Args)
+		if op.hasResult() {
+			g.message(op.Name+"Result", fmt.Sprintf("result of %s", op.Name), op.Result)
+		}
+		g.adapter(op)
+	}
+	for _, n := range f.Notifications {
+		g.message(n.Name+"Notification", fmt.Sprintf("body of the %s notification", n.Name), n.Fields)
+	}
+
+	g.printf("// RegisterRoutes binds every operation in %s to its handler.\n", source)
+	g.printf("func RegisterRoutes(router *FlightsRouter) {\n")
+	for _, op := range f.Operations {
+		g.printf("router.HandleFunc(Selector%s, handle%s)\n", op.Name, op.Name)
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Operations describes every operation in %s, keyed by selector.\n", source)
+	g.printf("var Operations = map[uint32]Operation{\n")
+	for _, op := range f.Operations {
+		g.printf("Selector%s: {\n", op.Name)
+		g.printf("Name: %q,\nSelector: Selector%s,\n", op.Name, op.Name)
+		g.printf("NewArgs: func() Message { return &%sArgs{} },\n", op.Name)
+		if op.hasResult() {
+			g.printf("NewResult: func() Message { return &%sResult{} },\n", op.Name)
+			g.printf("ResultAlways: %t,\n", op.ResultAlways)
+		}
+		if op.Idempotent {
+			g.printf("Idempotent: true,\n")
+		}
+		g.printf("},\n")
+	}
+	g.printf("}\n\n")
+
+	g.printf("// HTTPRoutes lists the operations in %s exposed over HTTP.\n", source)
+	g.printf("var HTTPRoutes = []HTTPRoute{\n")
+	for _, op := range f.Operations {
+		if op.HTTPMethod != "" {
+			g.printf("{Method: %q, Path: %q, Selector: Selector%s},\n", op.HTTPMethod, op.HTTPPath, op.Name)
+		}
+	}
+	g.printf("}\n\n")
+
+	g.printf("// Notifications describes every notification in %s, keyed by selector.\n", source)
+	g.printf("var Notifications = map[uint32]Notification{\n")
+	for _, n := range f.Notifications {
+		g.printf("Selector%s: {\n", n.Name)
+		g.printf("Name: %q,\nSelector: Selector%s,\n", n.Name, n.Name)
+		g.printf("New: func() Message { return &%sNotification{} },\n", n.Name)
+		g.printf("},\n")
+	}
+	g.printf("}\n")
+
+	out, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, g.buf.String())
+	}
+	return out, nil
+}
+
+func (op Operation) hasResult() bool {
+	return len(op.Result) > 0 || op.ResultAlways
+}
+
+type generator struct {
+	buf bytes.Buffer
+	tmp int // numbers the length variables of decoded sequences
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) message(name string, doc string, fields []Field) {
+	g.printf("// %s holds the %s.\n", name, doc)
+	g.printf("type %s struct {\n", name)
+	for _, f := range fields {
+		g.printf("%s %s `json:\"%s\"`\n", exported(f.Name), goType(f.Type), f.Name)
+	}
+	g.printf("}\n\n")
+
+	g.printf("func (m *%s) Encode(e *marshal.Encoder) {\n", name)
+	for _, f := range fields {
+		g.encode("m."+exported(f.Name), f.Type, 0)
+	}
+	g.printf("}\n\n")
+
+	g.printf("func (m *%s) Decode(d *marshal.Decoder) error {\n", name)
+	if len(fields) > 0 {
+		g.printf("var err error\n")
+	}
+	for _, f := range fields {
+		g.decode("m."+exported(f.Name), f.Type, 0)
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+func (g *generator) encode(target string, t Type, depth int) {
+	switch {
+	case t.Elem == nil:
+		g.printf("e.Write%s(%s)\n", primitives[t.Name].method, target)
+	case t.Elem.Name == "uint32":
+		g.printf("e.WriteUint32Array(%s)\n", target)
+	default:
+		v := fmt.Sprintf("v%d", depth)
+		g.printf("e.WriteUint32(uint32(len(%s)))\n", target)
+		g.printf("for _, %s := range %s {\n", v, target)
+		g.encode(v, *t.Elem, depth+1)
+		g.printf("}\n")
+	}
+}
+
+func (g *generator) decode(target string, t Type, depth int) {
+	switch {
+	case t.Elem == nil:
+		g.printf("if %s, err = d.Read%s(); err != nil {\nreturn err\n}\n", target, primitives[t.Name].method)
+	case t.Elem.Name == "uint32":
+		g.printf("if %s, err = d.ReadUint32Array(); err != nil {\nreturn err\n}\n", target)
+	default:
+		g.tmp++
+		n := fmt.Sprintf("n%d", g.tmp)
+		i := fmt.Sprintf("i%d", depth)
+		g.printf("%s, err := d.ReadLength(%d)\nif err != nil {\nreturn err\n}\n", n, minSize(*t.Elem))
+		g.printf("%s = make(%s, %s)\n", target, goType(t), n)
+		g.printf("for %s := range %s {\n", i, target)
+		g.decode(fmt.Sprintf("%s[%s]", target, i), *t.Elem, depth+1)
+		g.printf("}\n")
+	}
+}
+
+func (g *generator) adapter(op Operation) {
+	// the zero result of an "always" operation stands in for a missing one
+	noResult := "nil"
+	if op.ResultAlways {
+		noResult = fmt.Sprintf("&%sResult{}", op.Name)
+	}
+
+	g.printf("func handle%s(req *codec.Body, fdb *FlightDatabase, client Client) (uint32, any) {\n", op.Name)
+	g.printf("var args %sArgs\n", op.Name)
+	g.printf("if err := req.DecodePayload(&args); err != nil {\n")
+	g.printf("return malformedRequest(err), %s\n}\n\n", noResult)
+
+	if !op.hasResult() {
+		g.printf("return %sHandler(&args, fdb, client), nil\n", op.Name)
+		g.printf("}\n\n")
+		return
+	}
+	g.printf("status, result := %sHandler(&args, fdb, client)\n", op.Name)
+	g.printf("if result == nil {\nreturn status, %s\n}\n", noResult)
+	g.printf("return status, result\n")
+	g.printf("}\n\n")
+}
+
+func goType(t Type) string {
+	if t.Elem != nil {
+		return "[]" + goType(*t.Elem)
+	}
+	return primitives[t.Name].goType
+}
+
+// minSize is the fewest bytes one value of t can occupy on the wire, used to
+// reject sequence counts that cannot fit in the payload.
+func minSize(t Type) int {
+	if t.Elem != nil {
+		return 4
+	}
+	return primitives[t.Name].size
+}
+
+// usesTime reports whether any declaration in f has a time field, in which
+// case the generated file must import the time package.
+func (f *File) usesTime() bool {
+	var fields []Field
+	for _, op := range f.Operations {
+		fields = append(fields, op.Args...)
+		fields = append(fields, op.Result...)
+	}
+	for _, n := range f.Notifications {
+		fields = append(fields, n.Fields...)
+	}
+	for _, field := range fields {
+		t := field.Type
+		for t.Elem != nil {
+			t = *t.Elem
+		}
+		if t.Name == "time" {
+			return true
+		}
+	}
+	return false
+}
+
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,495 @@
+// Package idl parses the interface definition files that describe the flight
+// protocol and generates the Go types and route registration for them.
+//
+// A definition file is a list of declarations:
+//
+//	# comments run to the end of the line
+//	status NotFound 404
+//
+//	operation GetFlights = 1 {
+//		args {
+//			source string
+//			destination string
+//		}
+//		result {
+//			flightIds []uint32
+//		}
+//		returns OK NotFound BadRequest
+//		http GET /flights
+//	}
+//
+//	notification SeatAvailability = 8888 {
+//		id uint32
+//		seatsLeft uint32
+//	}
+//
+// An operation named X is served by the hand-written XHandler. Its result is
+// encoded after the status whenever the handler returns one; marking it
+// `result always { ... }` sends the zero result on every reply instead. An
+// `idempotent` line inside the operation declares that running it twice has
+// the same effect as running it once, so duplicates may simply be re-executed.
+// An `http METHOD /path` line exposes the operation over the HTTP gateway;
+// path segments such as :id are filled into the argument of that name, and
+// the other arguments come from the query string for GET and DELETE or from
+// the JSON body otherwise.
+package idl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type File struct {
+	Statuses      []Status
+	Operations    []Operation
+	Notifications []Notification
+}
+
+type Status struct {
+	Name string
+	Code uint32
+}
+
+type Operation struct {
+	Name         string
+	Selector     uint32
+	Args         []Field
+	Result       []Field
+	ResultAlways bool
+	Returns      []string
+	Idempotent   bool
+	// HTTPMethod and HTTPPath expose the operation over HTTP, empty if not.
+	HTTPMethod string
+	HTTPPath   string
+}
+
+type Notification struct {
+	Name     string
+	Selector uint32
+	Fields   []Field
+}
+
+type Field struct {
+	Name string
+	Type Type
+}
+
+// Type is a wire type: either a primitive name such as "uint32" or a
+// sequence of an element type.
+type Type struct {
+	Name string
+	Elem *Type
+}
+
+func (t Type) String() string {
+	if t.Elem != nil {
+		return "[]" + t.Elem.String()
+	}
+	return t.Name
+}
+
+// primitives maps every IDL primitive to the Go type it is generated as, the
+// suffix of the matching marshal.Encoder Write / marshal.Decoder Read methods
+// and the fewest bytes it occupies on the wire.
+var primitives = map[string]struct {
+	goType, method string
+	size           int
+}{
+	"bool":    {"bool", "Bool", 1},
+	"int8":    {"int8", "Int8", 1},
+	"uint8":   {"uint8", "Uint8", 1},
+	"int16":   {"int16", "Int16", 2},
+	"uint16":  {"uint16", "Uint16", 2},
+	"int32":   {"int32", "Int32", 4},
+	"uint32":  {"uint32", "Uint32", 4},
+	"int64":   {"int64", "Int64", 8},
+	"uint64":  {"uint64", "Uint64", 8},
+	"float32": {"float32", "Float32", 4},
+	"float64": {"float64", "Float64", 8},
+	"string":  {"string", "String", 4},
+	"octets":  {"[]byte", "Octets", 4},
+	"time":    {"time.Time", "Time", 8},
+}
+
+// Parse reads a definition file. name is only used in error messages.
+func Parse(name string, src string) (*File, error) {
+	p := &parser{name: name, toks: tokenize(src)}
+	f := &File{}
+	if err := p.file(f); err != nil {
+		return nil, err
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return f, nil
+}
+
+func (f *File) validate() error {
+	statuses := make(map[string]bool)
+	for _, s := range f.Statuses {
+		if statuses[s.Name] {
+			return fmt.Errorf("status %s declared twice", s.Name)
+		}
+		statuses[s.Name] = true
+	}
+
+	selectors := make(map[uint32]string)
+	names := make(map[string]bool)
+	endpoints := make(map[string]string)
+	check := func(name string, selector uint32, fieldSets ...[]Field) error {
+		if names[name] {
+			return fmt.Errorf("%s declared twice", name)
+		}
+		names[name] = true
+		if other, ok := selectors[selector]; ok {
+			return fmt.Errorf("%s reuses selector %d of %s", name, selector, other)
+		}
+		selectors[selector] = name
+		for _, fields := range fieldSets {
+			seen := make(map[string]bool)
+			for _, field := range fields {
+				if seen[field.Name] {
+					return fmt.Errorf("%s: field %s declared twice", name, field.Name)
+				}
+				seen[field.Name] = true
+			}
+		}
+		return nil
+	}
+
+	for _, op := range f.Operations {
+		if err := check(op.Name, op.Selector, op.Args, op.Result); err != nil {
+			return err
+		}
+		if len(op.Returns) == 0 {
+			return fmt.Errorf("%s: missing returns", op.Name)
+		}
+		for _, r := range op.Returns {
+			if !statuses[r] {
+				return fmt.Errorf("%s: unknown status %s", op.Name, r)
+			}
+		}
+		if op.HTTPMethod != "" {
+			if err := op.validateHTTP(); err != nil {
+				return fmt.Errorf("%s: %w", op.Name, err)
+			}
+			endpoint := op.HTTPMethod + " " + op.HTTPPath
+			if other, ok := endpoints[endpoint]; ok {
+				return fmt.Errorf("%s reuses http %s of %s", op.Name, endpoint, other)
+			}
+			endpoints[endpoint] = op.Name
+		}
+	}
+	for _, n := range f.Notifications {
+		if err := check(n.Name, n.Selector, n.Fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateHTTP checks the method of op and that every parameter in its path
+// names a scalar argument.
+func (op Operation) validateHTTP() error {
+	switch op.HTTPMethod {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return fmt.Errorf("unknown http method %s", op.HTTPMethod)
+	}
+	if !strings.HasPrefix(op.HTTPPath, "/") {
+		return fmt.Errorf("http path %s must start with /", op.HTTPPath)
+	}
+	for _, param := range op.PathParams() {
+		var field *Field
+		for i := range op.Args {
+			if op.Args[i].Name == param {
+				field = &op.Args[i]
+			}
+		}
+		if field == nil {
+			return fmt.Errorf("http path parameter %s is not an argument", param)
+		}
+		if field.Type.Elem != nil || field.Type.Name == "octets" {
+			return fmt.Errorf("http path parameter %s must be a scalar", param)
+		}
+	}
+	return nil
+}
+
+// PathParams returns the names of the parameters in the HTTP path of op.
+func (op Operation) PathParams() []string {
+	var params []string
+	for _, segment := range strings.Split(op.HTTPPath, "/") {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+		}
+	}
+	return params
+}
+
+type token struct {
+	text string
+	line int
+}
+
+func tokenize(src string) []token {
+	var toks []token
+	for i, line := range strings.Split(src, "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		for _, text := range strings.FieldsFunc(line, unicode.IsSpace) {
+			// split punctuation off identifiers so "{" and "=" need no spacing
+			for text != "" {
+				j := strings.IndexAny(text, "{}=")
+				if j < 0 {
+					toks = append(toks, token{text, i + 1})
+					break
+				}
+				if j > 0 {
+					toks = append(toks, token{text[:j], i + 1})
+				}
+				toks = append(toks, token{text[j : j+1], i + 1})
+				text = text[j+1:]
+			}
+		}
+	}
+
+	return toks
+}
+
+type parser struct {
+	name string
+	toks []token
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line := 0
+	if p.pos < len(p.toks) {
+		line = p.toks[p.pos].line
+	} else if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].line
+	}
+	return fmt.Errorf("%s:%d: %s", p.name, line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos].text
+}
+
+func (p *parser) next() (string, error) {
+	if p.pos >= len(p.toks) {
+		return "", p.errorf("unexpected end of file")
+	}
+	p.pos++
+	return p.toks[p.pos-1].text, nil
+}
+
+func (p *parser) expect(text string) error {
+	got, err := p.next()
+	if err != nil {
+		return err
+	}
+	if got != text {
+		p.pos--
+		return p.errorf("expected %q, found %q", text, got)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	text, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	for i, r := range text {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			p.pos--
+			return "", p.errorf("invalid identifier %q", text)
+		}
+	}
+	return text, nil
+}
+
+func (p *parser) number() (uint32, error) {
+	text, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(text, 10, 32)
+	if err != nil {
+		p.pos--
+		return 0, p.errorf("invalid number %q", text)
+	}
+	return uint32(n), nil
+}
+
+func (p *parser) file(f *File) error {
+	for p.pos < len(p.toks) {
+		keyword, _ := p.next()
+		switch keyword {
+		case "status":
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			code, err := p.number()
+			if err != nil {
+				return err
+			}
+			f.Statuses = append(f.Statuses, Status{Name: name, Code: code})
+		case "operation":
+			op, err := p.operation()
+			if err != nil {
+				return err
+			}
+			f.Operations = append(f.Operations, op)
+		case "notification":
+			n, err := p.notification()
+			if err != nil {
+				return err
+			}
+			f.Notifications = append(f.Notifications, n)
+		default:
+			p.pos--
+			return p.errorf("unexpected %q", keyword)
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) header() (string, uint32, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := p.expect("="); err != nil {
+		return "", 0, err
+	}
+	selector, err := p.number()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := p.expect("{"); err != nil {
+		return "", 0, err
+	}
+	return name, selector, nil
+}
+
+func (p *parser) operation() (Operation, error) {
+	var op Operation
+	var err error
+	if op.Name, op.Selector, err = p.header(); err != nil {
+		return op, err
+	}
+
+	for {
+		item, err := p.next()
+		if err != nil {
+			return op, err
+		}
+		switch item {
+		case "}":
+			return op, nil
+		case "args":
+			if err := p.expect("{"); err != nil {
+				return op, err
+			}
+			if op.Args, err = p.fields(); err != nil {
+				return op, err
+			}
+		case "result":
+			if p.peek() == "always" {
+				p.pos++
+				op.ResultAlways = true
+			}
+			if err := p.expect("{"); err != nil {
+				return op, err
+			}
+			if op.Result, err = p.fields(); err != nil {
+				return op, err
+			}
+		case "idempotent":
+			op.Idempotent = true
+		case "http":
+			if op.HTTPMethod, err = p.next(); err != nil {
+				return op, err
+			}
+			if op.HTTPPath, err = p.next(); err != nil {
+				return op, err
+			}
+		case "returns":
+			for p.peek() != "}" && p.peek() != "" && p.peek() != "args" && p.peek() != "result" && p.peek() != "idempotent" && p.peek() != "http" {
+				name, err := p.ident()
+				if err != nil {
+					return op, err
+				}
+				op.Returns = append(op.Returns, name)
+			}
+		default:
+			p.pos--
+			return op, p.errorf("unexpected %q in operation %s", item, op.Name)
+		}
+	}
+}
+
+func (p *parser) notification() (Notification, error) {
+	var n Notification
+	var err error
+	if n.Name, n.Selector, err = p.header(); err != nil {
+		return n, err
+	}
+	n.Fields, err = p.fields()
+	return n, err
+}
+
+// fields parses field declarations up to and including the closing brace.
+func (p *parser) fields() ([]Field, error) {
+	var fields []Field
+	for {
+		if p.peek() == "}" {
+			p.pos++
+			return fields, nil
+		}
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		typeName, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		t, err := parseType(typeName)
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("field %s: %v", name, err)
+		}
+		fields = append(fields, Field{Name: name, Type: t})
+	}
+}
+
+func parseType(text string) (Type, error) {
+	if strings.HasPrefix(text, "[]") {
+		elem, err := parseType(text[2:])
+		if err != nil {
+			return Type{}, err
+		}
+		return Type{Elem: &elem}, nil
+	}
+	if _, ok := primitives[text]; !ok {
+		return Type{}, fmt.Errorf("unknown type %q", text)
+	}
+	return Type{Name: text}, nil
+}
@@ -0,0 +1,108 @@
+package idl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The definitions of the service and the files generated from them by go
+// generate in internal/api.
+var apiDir = filepath.Join("..", "..", "internal", "api")
+
+func parseFlights(t *testing.T) *File {
+	t.Helper()
+	src, err := os.ReadFile(filepath.Join(apiDir, "flights.idl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse("flights.idl", string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestGenerateMatchesGolden(t *testing.T) {
+	f := parseFlights(t)
+	code, err := Generate(f, "api", "flights.idl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := OpenAPI(f, "goflysys", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, got := range map[string][]byte{"flights_gen.go": code, "openapi.json": doc} {
+		want, err := os.ReadFile(filepath.Join(apiDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run go generate ./internal/api", file)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	positioned := regexp.MustCompile(`^test\.idl:\d+: `)
+	for _, src := range []string{
+		"stat NotFound 404",
+		"status 404",
+		"status NotFound four",
+		"status OK 200\noperation = 1 { returns OK }",
+		"status OK 200\noperation Get 1 { returns OK }",
+		"status OK 200\noperation Get = -1 { returns OK }",
+		"status OK 200\noperation Get = 1 returns OK }",
+		"status OK 200\noperation Get = 1 { args { id } returns OK }",
+		"status OK 200\noperation Get = 1 { args { id uint128 } returns OK }",
+		"status OK 200\noperation Get = 1 { args { id []map } returns OK }",
+		"status OK 200\noperation Get = 1 { returns OK 2xx }",
+		"status OK 200\noperation Get = 1 { returns OK\n} }",
+		"status OK 200\noperation Get = 1 { returns OK",
+		"status OK 200\noperation Get = 1 { http GET",
+		"notification Seats = 1 { id uint32",
+	} {
+		f, err := Parse("test.idl", src)
+		if err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", src, f)
+			continue
+		}
+		if !positioned.MatchString(err.Error()) {
+			t.Errorf("Parse(%q): %q has no position", src, err)
+		}
+	}
+}
+
+func TestTruncatedNoPanic(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join(apiDir, "flights.idl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every prefix must fail or parse, never panic
+	for i := range src {
+		Parse("flights.idl", string(src[:i]))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		src, want string
+	}{
+		{"status OK 200\nstatus OK 201", "status OK declared twice"},
+		{"operation Get = 1 { returns Gone }", "unknown status Gone"},
+		{"operation Get = 1 { }", "missing returns"},
+		{"status OK 200\noperation A = 1 { returns OK }\noperation B = 1 { returns OK }", "reuses selector 1"},
+		{"status OK 200\noperation A = 1 { args { id uint32 id string } returns OK }", "field id declared twice"},
+		{"status OK 200\noperation A = 1 { returns OK http GET /a/:id }", "parameter id is not an argument"},
+		{"status OK 200\noperation A = 1 { args { ids []uint32 } returns OK http GET /a/:ids }", "must be a scalar"},
+		{"status OK 200\noperation A = 1 { returns OK http FETCH /a }", "unknown http method"},
+	} {
+		if _, err := Parse("test.idl", tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package idl
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// OpenAPI returns an OpenAPI 3.0 document, as indented JSON, describing the
+// operations in f that are exposed over HTTP.
+func OpenAPI(f *File, title, version string) ([]byte, error) {
+	codes := make(map[string]uint32)
+	for _, s := range f.Statuses {
+		codes[s.Name] = s.Code
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, op := range f.Operations {
+		if op.HTTPMethod == "" {
+			continue
+		}
+		path := openAPIPath(op.HTTPPath)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.HTTPMethod)] = openAPIOperation(op, codes)
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Error": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"error": map[string]any{"type": "string"}},
+				},
+			},
+			"parameters": map[string]any{
+				"ClientId": map[string]any{
+					"name":        "X-Client-Id",
+					"in":          "header",
+					"description": "16 hex digits identifying the client, as the clientId of the UDP protocol; defaults to the connection",
+					"schema":      map[string]any{"type": "string", "pattern": "^[0-9a-fA-F]{1,16}$"},
+				},
+			},
+		},
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// openAPIPath turns the :param segments of path into {param}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func openAPIOperation(op Operation, codes map[string]uint32) map[string]any {
+	inPath := make(map[string]bool)
+	for _, param := range op.PathParams() {
+		inPath[param] = true
+	}
+	inQuery := op.HTTPMethod == "GET" || op.HTTPMethod == "DELETE"
+
+	// path parameters and, for GET and DELETE, query parameters; the other
+	// arguments make up the JSON body
+	params := []any{map[string]any{"$ref": "#/components/parameters/ClientId"}}
+	var body []Field
+	for _, field := range op.Args {
+		switch {
+		case inPath[field.Name]:
+			params = append(params, map[string]any{"name": field.Name, "in": "path", "required": true, "schema": schema(field.Type)})
+		case inQuery:
+			params = append(params, map[string]any{"name": field.Name, "in": "query", "schema": schema(field.Type)})
+		default:
+			body = append(body, field)
+		}
+	}
+
+	responses := make(map[string]any)
+	for _, name := range op.Returns {
+		code := codes[name]
+		response := map[string]any{"description": name}
+		content := map[string]any{"$ref": "#/components/schemas/Error"}
+		if code < 400 {
+			content = fieldsSchema(op.Result)
+		}
+		response["content"] = map[string]any{"application/json": map[string]any{"schema": content}}
+		responses[strconv.FormatUint(uint64(code), 10)] = response
+	}
+	responses["503"] = map[string]any{
+		"description": "Overloaded",
+		"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+	}
+
+	operation := map[string]any{
+		"operationId": op.Name,
+		"parameters":  params,
+		"responses":   responses,
+	}
+	if len(body) > 0 {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": fieldsSchema(body)}},
+		}
+	}
+	return operation
+}
+
+// fieldsSchema returns the schema of an object with fields, all of them
+// required.
+func fieldsSchema(fields []Field) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for _, field := range fields {
+		properties[field.Name] = schema(field.Type)
+		required = append(required, field.Name)
+	}
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// schema returns the JSON schema of values of t as encoding/json writes them.
+func schema(t Type) map[string]any {
+	if t.Elem != nil {
+		return map[string]any{"type": "array", "items": schema(*t.Elem)}
+	}
+	switch t.Name {
+	case "bool":
+		return map[string]any{"type": "boolean"}
+	case "int8", "int16", "int32":
+		return map[string]any{"type": "integer", "format": "int32"}
+	case "int64":
+		return map[string]any{"type": "integer", "format": "int64"}
+	case "uint8", "uint16", "uint32", "uint64":
+		return map[string]any{"type": "integer", "minimum": 0}
+	case "float32":
+		return map[string]any{"type": "number", "format": "float"}
+	case "float64":
+		return map[string]any{"type": "number", "format": "double"}
+	case "octets":
+		return map[string]any{"type": "string", "format": "byte"}
+	case "time":
+		return map[string]any{"type": "string", "format": "date-time"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
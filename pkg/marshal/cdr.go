@@ -0,0 +1,110 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedEncapsulation is returned by NewCDRDecoder when the payload
+// does not start with a plain CDR encapsulation header.
+var ErrUnsupportedEncapsulation = errors.New("marshal: unsupported CDR encapsulation")
+
+// Encapsulation identifiers from the OMG CDR specification. A payload in CDR
+// mode starts with the identifier (2 bytes, always big-endian) followed by 2
+// bytes of options, which are written as zero and ignored on read.
+const (
+	EncapsulationCDRBigEndian    uint16 = 0x0000
+	EncapsulationCDRLittleEndian uint16 = 0x0001
+	encapsulationHeaderLen              = 4
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+func orderOf(order binary.ByteOrder) byteOrder {
+	if order == binary.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// NewCDREncoder returns an Encoder in OMG-compatible CDR mode. After any
+// prefix already in buf it writes the encapsulation header for order, then
+// aligns every 2, 4 and 8-byte primitive to its natural boundary relative to
+// the end of that header. Strings are NUL-terminated and their length
+// includes the terminator, as the specification requires.
+func NewCDREncoder(buf []byte, order binary.ByteOrder) *Encoder {
+	e := &Encoder{buf: buf, order: orderOf(order), aligned: true}
+	id := EncapsulationCDRBigEndian
+	if e.order == binary.LittleEndian {
+		id = EncapsulationCDRLittleEndian
+	}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, id)
+	e.buf = append(e.buf, 0, 0)
+	e.origin = len(e.buf)
+
+	return e
+}
+
+// NewCDRDecoder reads the encapsulation header at the start of data and
+// returns a Decoder for the byte order it declares, with CDR alignment.
+func NewCDRDecoder(data []byte) (*Decoder, error) {
+	if len(data) < encapsulationHeaderLen {
+		return nil, fmt.Errorf("%w: need %d bytes for the encapsulation header, have %d", ErrShortBuffer, encapsulationHeaderLen, len(data))
+	}
+
+	d := &Decoder{data: data, off: encapsulationHeaderLen, origin: encapsulationHeaderLen, aligned: true}
+	switch id := binary.BigEndian.Uint16(data); id {
+	case EncapsulationCDRBigEndian:
+		d.order = binary.BigEndian
+	case EncapsulationCDRLittleEndian:
+		d.order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("%w: identifier %#04x", ErrUnsupportedEncapsulation, id)
+	}
+
+	return d, nil
+}
+
+// CDR reports whether d decodes in OMG-compatible CDR mode.
+func (d *Decoder) CDR() bool {
+	return d.aligned
+}
+
+// ByteOrder returns the byte order d decodes with.
+func (d *Decoder) ByteOrder() binary.ByteOrder {
+	return d.order
+}
+
+// ReplyEncoder returns an Encoder appending to buf in the same mode and byte
+// order as d, so a reply mirrors the representation of its request.
+func (d *Decoder) ReplyEncoder(buf []byte) *Encoder {
+	if d.aligned {
+		return NewCDREncoder(buf, d.order)
+	}
+	return NewEncoder(buf)
+}
+
+// pad writes zero bytes until the payload is aligned to n.
+func (e *Encoder) pad(n int) {
+	if !e.aligned {
+		return
+	}
+	for (len(e.buf)-e.origin)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// pad skips the padding that aligns the next value to n.
+func (d *Decoder) pad(n int) error {
+	if !d.aligned {
+		return nil
+	}
+	skip := (n - (d.off-d.origin)%n) % n
+	_, err := d.next(skip)
+
+	return err
+}
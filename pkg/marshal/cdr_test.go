@@ -0,0 +1,76 @@
+package marshal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCDRPadding(t *testing.T) {
+	type padded struct {
+		A uint8
+		B uint32
+		C uint16
+		D uint64
+		E string
+	}
+	v := padded{A: 1, B: 2, C: 3, D: 4, E: "hi"}
+	for _, tt := range []struct {
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{binary.BigEndian, []byte{
+			0, 0, 0, 0, // encapsulation header
+			1, 0, 0, 0, // A and padding to 4
+			0, 0, 0, 2, // B
+			0, 3, 0, 0, 0, 0, 0, 0, // C and padding to 8
+			0, 0, 0, 0, 0, 0, 0, 4, // D
+			0, 0, 0, 3, 'h', 'i', 0, // E with its NUL
+		}},
+		{binary.LittleEndian, []byte{
+			0, 1, 0, 0,
+			1, 0, 0, 0,
+			2, 0, 0, 0,
+			3, 0, 0, 0, 0, 0, 0, 0,
+			4, 0, 0, 0, 0, 0, 0, 0,
+			3, 0, 0, 0, 'h', 'i', 0,
+		}},
+	} {
+		data, err := MarshalCDR(v, tt.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, tt.want) {
+			t.Errorf("%v:\n got % x\nwant % x", tt.order, data, tt.want)
+		}
+		var got padded
+		if err := UnmarshalCDR(data, &got); err != nil || got != v {
+			t.Errorf("%v: got %+v, %v; want %+v", tt.order, got, err, v)
+		}
+	}
+}
+
+func TestCDRStrings(t *testing.T) {
+	for _, order := range []byteOrder{binary.BigEndian, binary.LittleEndian} {
+		// an empty string is its NUL, with a length of 1
+		e := NewCDREncoder(nil, order)
+		e.WriteString("")
+		if got, want := e.Bytes()[encapsulationHeaderLen:], append(order.AppendUint32(nil, 1), 0); !bytes.Equal(got, want) {
+			t.Errorf("%v: empty string encoded as % x, want % x", order, got, want)
+		}
+		d, _ := NewCDRDecoder(e.Bytes())
+		if s, err := d.ReadString(); err != nil || s != "" {
+			t.Errorf("%v: ReadString() = %q, %v", order, s, err)
+		}
+
+		for _, body := range [][]byte{
+			order.AppendUint32(nil, 0),
+			append(order.AppendUint32(nil, 2), 'a', 'b'),
+		} {
+			d, _ := NewCDRDecoder(append(NewCDREncoder(nil, order).Bytes(), body...))
+			if s, err := d.ReadString(); err == nil {
+				t.Errorf("%v: ReadString() of % x = %q, want an error", order, body, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	// ErrShortBuffer is returned when a value extends past the end of the payload.
+	ErrShortBuffer = errors.New("marshal: short buffer")
+	// ErrStringTooLong is returned when a string's length prefix exceeds the
+	// bytes left in the payload. It wraps ErrShortBuffer.
+	ErrStringTooLong = fmt.Errorf("%w: string too long", ErrShortBuffer)
+	// ErrTrailingBytes is returned by Finish when the payload has not been fully consumed.
+	ErrTrailingBytes = errors.New("marshal: trailing bytes")
+	// ErrInvalidEnum is returned when an enumeration value is out of range.
+	ErrInvalidEnum = errors.New("marshal: invalid enum value")
+	// ErrDuplicateKey is returned when a map repeats a key.
+	ErrDuplicateKey = errors.New("marshal: duplicate map key")
+)
+
+// Decoder reads values sequentially from a payload, tracking the read offset
+// and returning an error instead of panicking on malformed input.
+type Decoder struct {
+	data    []byte
+	off     int
+	order   byteOrder
+	aligned bool // OMG CDR mode, see NewCDRDecoder
+	origin  int  // offset alignment is measured from
+}
+
+// NewDecoder returns a Decoder for big-endian values without alignment, as
+// written by NewEncoder and the Marshal helpers.
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data, order: binary.BigEndian}
+}
+
+// Offset returns the number of bytes consumed so far.
+func (d *Decoder) Offset() int {
+	return d.off
+}
+
+// Remaining returns the number of unread bytes.
+func (d *Decoder) Remaining() int {
+	return len(d.data) - d.off
+}
+
+// Rest returns the unread bytes without consuming them.
+func (d *Decoder) Rest() []byte {
+	return d.data[d.off:]
+}
+
+// Finish reports ErrTrailingBytes if any bytes are left unread.
+func (d *Decoder) Finish() error {
+	if d.Remaining() != 0 {
+		return fmt.Errorf("%w: %d unread at offset %d", ErrTrailingBytes, d.Remaining(), d.off)
+	}
+
+	return nil
+}
+
+func (d *Decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.Remaining() < n {
+		return nil, fmt.Errorf("%w: need %d bytes at offset %d, have %d", ErrShortBuffer, n, d.off, d.Remaining())
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+
+	return b, nil
+}
+
+// length reads a uint32 count of elements that each take at least elemSize
+// bytes, rejecting counts that could not fit in the rest of the payload.
+func (d *Decoder) length(elemSize int) (int, error) {
+	n, err := d.ReadUint32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n)*uint64(elemSize) > uint64(d.Remaining()) {
+		return 0, fmt.Errorf("%w: %d elements of %d bytes at offset %d, have %d", ErrShortBuffer, n, elemSize, d.off, d.Remaining())
+	}
+
+	return int(n), nil
+}
+
+func (d *Decoder) ReadUint32() (uint32, error) {
+	if err := d.pad(4); err != nil {
+		return 0, err
+	}
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint32(b), nil
+}
+
+func (d *Decoder) ReadInt64() (int64, error) {
+	n, err := d.ReadUint64()
+
+	return int64(n), err
+}
+
+func (d *Decoder) ReadFloat64() (float64, error) {
+	n, err := d.ReadUint64()
+
+	return math.Float64frombits(n), err
+}
+
+func (d *Decoder) ReadBool() (bool, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return false, err
+	}
+
+	return b[0] != 0, nil
+}
+
+func (d *Decoder) ReadString() (string, error) {
+	n, err := d.ReadUint32()
+	if err != nil {
+		return "", err
+	}
+	if uint64(n) > uint64(d.Remaining()) {
+		return "", fmt.Errorf("%w: length %d at offset %d, have %d", ErrStringTooLong, n, d.off, d.Remaining())
+	}
+	b, _ := d.next(int(n))
+	if d.aligned {
+		// the length counts the NUL, so even an empty string has one
+		if n == 0 {
+			return "", fmt.Errorf("marshal: string at offset %d has length 0 and no NUL", d.off)
+		}
+		if b[n-1] != 0 {
+			return "", fmt.Errorf("marshal: string at offset %d is not NUL-terminated", d.off-int(n))
+		}
+		b = b[:n-1]
+	}
+
+	return string(b), nil
+}
+
+func (d *Decoder) ReadUint32Array() ([]uint32, error) {
+	n, err := d.length(4)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]uint32, n)
+	for i := range data {
+		data[i], _ = d.ReadUint32()
+	}
+
+	return data, nil
+}
+
+// ReadLength reads a uint32 sequence count whose elements each occupy at
+// least elemSize bytes, failing with ErrShortBuffer if they cannot all fit.
+func (d *Decoder) ReadLength(elemSize int) (int, error) {
+	return d.length(elemSize)
+}
+
+func (d *Decoder) ReadInt8() (int8, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return int8(b[0]), nil
+}
+
+func (d *Decoder) ReadUint8() (uint8, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+func (d *Decoder) ReadInt16() (int16, error) {
+	n, err := d.ReadUint16()
+
+	return int16(n), err
+}
+
+func (d *Decoder) ReadUint16() (uint16, error) {
+	if err := d.pad(2); err != nil {
+		return 0, err
+	}
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint16(b), nil
+}
+
+func (d *Decoder) ReadInt32() (int32, error) {
+	n, err := d.ReadUint32()
+
+	return int32(n), err
+}
+
+func (d *Decoder) ReadUint64() (uint64, error) {
+	if err := d.pad(8); err != nil {
+		return 0, err
+	}
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.order.Uint64(b), nil
+}
+
+func (d *Decoder) ReadFloat32() (float32, error) {
+	n, err := d.ReadUint32()
+
+	return math.Float32frombits(n), err
+}
+
+// ReadOctets reads an octet sequence. The returned slice is a copy.
+func (d *Decoder) ReadOctets() ([]byte, error) {
+	n, err := d.length(1)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := d.next(n)
+
+	return append([]byte(nil), b...), nil
+}
+
+// ReadEnum reads an enumeration value and checks it is below count.
+func (d *Decoder) ReadEnum(count uint32) (uint32, error) {
+	n, err := d.ReadUint32()
+	if err != nil {
+		return 0, err
+	}
+	if n >= count {
+		return 0, fmt.Errorf("%w: %d of %d at offset %d", ErrInvalidEnum, n, count, d.off-4)
+	}
+
+	return n, nil
+}
+
+// ReadTime reads a time written by WriteTime. The result is in UTC.
+func (d *Decoder) ReadTime() (time.Time, error) {
+	n, err := d.ReadInt64()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, n).UTC(), nil
+}
+
+// ReadSequence reads a uint32 count followed by that many elements, each of
+// which occupies at least minSize bytes.
+func ReadSequence[T any](d *Decoder, minSize int, read func(*Decoder) (T, error)) ([]T, error) {
+	n, err := d.length(minSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadArray(d, n, read)
+}
+
+// ReadArray reads exactly n elements with no count prefix.
+func ReadArray[T any](d *Decoder, n int, read func(*Decoder) (T, error)) ([]T, error) {
+	data := make([]T, n)
+	for i := range data {
+		v, err := read(d)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = v
+	}
+
+	return data, nil
+}
+
+// ReadOptional reads a presence flag and, when set, the value that follows.
+// It returns nil for an absent value.
+func ReadOptional[T any](d *Decoder, read func(*Decoder) (T, error)) (*T, error) {
+	present, err := d.ReadBool()
+	if err != nil || !present {
+		return nil, err
+	}
+	v, err := read(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// ReadMap reads a map written by WriteMap. Every pair occupies at least
+// minSize bytes; repeated keys are rejected with ErrDuplicateKey.
+func ReadMap[K comparable, V any](d *Decoder, minSize int, readKey func(*Decoder) (K, error), readValue func(*Decoder) (V, error)) (map[K]V, error) {
+	n, err := d.length(minSize)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[K]V, n)
+	for i := 0; i < n; i++ {
+		k, err := readKey(d)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := data[k]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrDuplicateKey, k)
+		}
+		v, err := readValue(d)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = v
+	}
+
+	return data, nil
+}
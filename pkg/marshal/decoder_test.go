@@ -0,0 +1,70 @@
+package marshal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecoderRoundTrip(t *testing.T) {
+	e := NewEncoder(nil)
+	e.WriteUint32(7)
+	e.WriteInt64(-8)
+	e.WriteFloat64(2.5)
+	e.WriteString("flight")
+	e.WriteUint32Array([]uint32{1, 2})
+
+	d := NewDecoder(e.Bytes())
+	u, err := d.ReadUint32()
+	if err != nil || u != 7 {
+		t.Errorf("ReadUint32() = %d, %v", u, err)
+	}
+	i, err := d.ReadInt64()
+	if err != nil || i != -8 {
+		t.Errorf("ReadInt64() = %d, %v", i, err)
+	}
+	f, err := d.ReadFloat64()
+	if err != nil || f != 2.5 {
+		t.Errorf("ReadFloat64() = %v, %v", f, err)
+	}
+	s, err := d.ReadString()
+	if err != nil || s != "flight" {
+		t.Errorf("ReadString() = %q, %v", s, err)
+	}
+	a, err := d.ReadUint32Array()
+	if err != nil || len(a) != 2 || a[0] != 1 || a[1] != 2 {
+		t.Errorf("ReadUint32Array() = %v, %v", a, err)
+	}
+	if err := d.Finish(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecoderShortBuffer(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		read func(*Decoder) error
+	}{
+		{"uint32", MarshalUint32(1)[:3], func(d *Decoder) error { _, err := d.ReadUint32(); return err }},
+		{"int64", MarshalInt64(1)[:7], func(d *Decoder) error { _, err := d.ReadInt64(); return err }},
+		{"float64", MarshalFloat64(1)[:4], func(d *Decoder) error { _, err := d.ReadFloat64(); return err }},
+		{"empty bool", nil, func(d *Decoder) error { _, err := d.ReadBool(); return err }},
+		{"string length", MarshalString("abc")[:2], func(d *Decoder) error { _, err := d.ReadString(); return err }},
+		{"string body", MarshalString("abc")[:6], func(d *Decoder) error { _, err := d.ReadString(); return err }},
+		{"string length too long", MarshalUint32(1 << 31), func(d *Decoder) error { _, err := d.ReadString(); return err }},
+		{"array too long", MarshalUint32(1 << 30), func(d *Decoder) error { _, err := d.ReadUint32Array(); return err }},
+		{"octets too long", MarshalUint32(5), func(d *Decoder) error { _, err := d.ReadOctets(); return err }},
+	} {
+		if err := tt.read(NewDecoder(tt.data)); !errors.Is(err, ErrShortBuffer) {
+			t.Errorf("%s: %v, want ErrShortBuffer", tt.name, err)
+		}
+	}
+}
+
+func TestDecoderTrailingBytes(t *testing.T) {
+	d := NewDecoder(append(MarshalUint32(1), 0))
+	d.ReadUint32()
+	if err := d.Finish(); !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("Finish() = %v, want ErrTrailingBytes", err)
+	}
+}
@@ -0,0 +1,170 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// Encoder appends values to a payload using the same representation the
+// Decoder reads.
+type Encoder struct {
+	buf     []byte
+	order   byteOrder
+	aligned bool // OMG CDR mode, see NewCDREncoder
+	origin  int  // offset alignment is measured from
+}
+
+// NewEncoder returns an Encoder that appends to buf, which may be nil or
+// already hold a prefix such as the request id. It writes big-endian values
+// without alignment, as the Marshal helpers do.
+func NewEncoder(buf []byte) *Encoder {
+	return &Encoder{buf: buf, order: binary.BigEndian}
+}
+
+// Bytes returns the encoded payload.
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Len returns the number of bytes encoded so far.
+func (e *Encoder) Len() int {
+	return len(e.buf)
+}
+
+func (e *Encoder) write(b ...byte) {
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) WriteUint32(data uint32) {
+	e.pad(4)
+	e.buf = e.order.AppendUint32(e.buf, data)
+}
+
+func (e *Encoder) WriteInt64(data int64) {
+	e.WriteUint64(uint64(data))
+}
+
+func (e *Encoder) WriteFloat64(data float64) {
+	e.WriteUint64(math.Float64bits(data))
+}
+
+func (e *Encoder) WriteBool(data bool) {
+	if data {
+		e.write(1)
+		return
+	}
+	e.write(0)
+}
+
+func (e *Encoder) WriteString(data string) {
+	if e.aligned {
+		e.WriteUint32(uint32(len(data) + 1))
+		e.buf = append(e.buf, data...)
+		e.buf = append(e.buf, 0)
+		return
+	}
+	e.WriteUint32(uint32(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+func (e *Encoder) WriteUint32Array(data []uint32) {
+	e.WriteUint32(uint32(len(data)))
+	for _, v := range data {
+		e.WriteUint32(v)
+	}
+}
+
+func (e *Encoder) WriteInt8(data int8) {
+	e.write(byte(data))
+}
+
+func (e *Encoder) WriteUint8(data uint8) {
+	e.write(data)
+}
+
+func (e *Encoder) WriteInt16(data int16) {
+	e.WriteUint16(uint16(data))
+}
+
+func (e *Encoder) WriteUint16(data uint16) {
+	e.pad(2)
+	e.buf = e.order.AppendUint16(e.buf, data)
+}
+
+func (e *Encoder) WriteInt32(data int32) {
+	e.WriteUint32(uint32(data))
+}
+
+func (e *Encoder) WriteUint64(data uint64) {
+	e.pad(8)
+	e.buf = e.order.AppendUint64(e.buf, data)
+}
+
+func (e *Encoder) WriteFloat32(data float32) {
+	e.WriteUint32(math.Float32bits(data))
+}
+
+// WriteOctets encodes an octet sequence: a uint32 length and the raw bytes.
+func (e *Encoder) WriteOctets(data []byte) {
+	e.WriteUint32(uint32(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+// WriteEnum encodes an enumeration value. Like CDR enums it always takes
+// four bytes.
+func (e *Encoder) WriteEnum(data uint32) {
+	e.WriteUint32(data)
+}
+
+// WriteTime encodes t as int64 nanoseconds since the Unix epoch; see
+// MarshalTime for the precision and range.
+func (e *Encoder) WriteTime(data time.Time) {
+	e.WriteInt64(data.UnixNano())
+}
+
+// WriteSequence encodes data as a uint32 count followed by every element.
+func WriteSequence[T any](e *Encoder, data []T, write func(*Encoder, T)) {
+	e.WriteUint32(uint32(len(data)))
+	WriteArray(e, data, write)
+}
+
+// WriteArray encodes a fixed-size array: the elements only, since the
+// receiver already knows how many there are.
+func WriteArray[T any](e *Encoder, data []T, write func(*Encoder, T)) {
+	for _, v := range data {
+		write(e, v)
+	}
+}
+
+// WriteOptional encodes a presence flag followed by *data when data is not nil.
+func WriteOptional[T any](e *Encoder, data *T, write func(*Encoder, T)) {
+	e.WriteBool(data != nil)
+	if data != nil {
+		write(e, *data)
+	}
+}
+
+// Ordered is the set of key types WriteMap can sort.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 | ~string
+}
+
+// WriteMap encodes data as a uint32 count followed by key/value pairs in
+// ascending key order, so equal maps always produce equal bytes.
+func WriteMap[K Ordered, V any](e *Encoder, data map[K]V, writeKey func(*Encoder, K), writeValue func(*Encoder, V)) {
+	keys := make([]K, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	e.WriteUint32(uint32(len(keys)))
+	for _, k := range keys {
+		writeKey(e, k)
+		writeValue(e, data[k])
+	}
+}
@@ -0,0 +1,244 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync/atomic"
+)
+
+// Every datagram starts with a fixed envelope, always big-endian:
+//
+//	magic uint16 | version uint8 | type uint8 | flags uint16 | bodyLength uint32
+//
+// followed, when FlagClientID is set, by clientId uint64, when FlagAck is set
+// by ack uint32, then bodyLength bytes of body and, when FlagChecksum is set,
+// a uint32 CRC32C (Castagnoli) of everything before it. For requests the body
+// is reqId uint32 | selector uint32 | args, for replies reqId uint32 | status
+// uint32 | result and for notifications selector uint32 | fields.
+const (
+	Magic           uint16 = 0x4746 // "GF"
+	ProtocolVersion uint8  = 1
+	EnvelopeLen            = 10
+)
+
+type MessageType uint8
+
+const (
+	MessageRequest MessageType = iota + 1
+	MessageReply
+	MessageNotification
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageRequest:
+		return "request"
+	case MessageReply:
+		return "reply"
+	case MessageNotification:
+		return "notification"
+	default:
+		return fmt.Sprintf("MessageType(%d)", uint8(t))
+	}
+}
+
+// Flags is a bitfield describing how the body is represented.
+type Flags uint16
+
+const (
+	// FlagCDR marks a body that is an OMG CDR encapsulation; see NewCDREncoder.
+	FlagCDR Flags = 1 << iota
+	// FlagChecksum marks a message that ends with a CRC32C trailer.
+	FlagChecksum
+	// FlagFragment marks one fragment of a larger message; see pkg/fragment.
+	FlagFragment
+)
+
+// Bits 3 and 4 of the flags select the body encoding; see pkg/codec.
+const (
+	CodecMask    Flags = 3 << 3
+	CodecCDR     Flags = 0 << 3
+	CodecJSON    Flags = 1 << 3
+	CodecMsgPack Flags = 2 << 3
+)
+
+// FlagClientID marks a request whose envelope carries the id its client chose
+// for itself, so the server recognises the client across address changes.
+const FlagClientID Flags = 1 << 5
+
+// FlagAck marks a request whose envelope acknowledges the replies to every
+// earlier request of its client up to and including request id Ack, so the
+// server can stop keeping them.
+const FlagAck Flags = 1 << 6
+
+// FlagSealed marks a message whose body is encrypted and authenticated with a
+// key shared between the client and the server; see pkg/secure.
+const FlagSealed Flags = 1 << 7
+
+const (
+	checksumLen = 4
+	clientIDLen = 8
+	ackLen      = 4
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	checksumFailures atomic.Uint64
+)
+
+// ChecksumFailures returns how many messages Open has rejected because their
+// CRC32C trailer did not match.
+func ChecksumFailures() uint64 {
+	return checksumFailures.Load()
+}
+
+var (
+	// ErrBadMagic is returned for datagrams that are not part of the protocol.
+	ErrBadMagic = errors.New("marshal: bad magic")
+	// ErrUnsupportedVersion is returned for envelopes of another protocol version.
+	ErrUnsupportedVersion = errors.New("marshal: unsupported protocol version")
+	// ErrUnknownMessageType is returned for envelopes with an unknown type.
+	ErrUnknownMessageType = errors.New("marshal: unknown message type")
+	// ErrBodyLength is returned when the body is not as long as the envelope says.
+	ErrBodyLength = errors.New("marshal: body length mismatch")
+	// ErrChecksum is returned when a message does not match its CRC32C trailer.
+	ErrChecksum = errors.New("marshal: checksum mismatch")
+)
+
+type Envelope struct {
+	Version    uint8
+	Type       MessageType
+	Flags      Flags
+	BodyLength uint32
+	ClientID   uint64 // only meaningful with FlagClientID
+	Ack        uint32 // only meaningful with FlagAck
+}
+
+// NewEnvelope returns an envelope of the current protocol version.
+func NewEnvelope(t MessageType, flags Flags) Envelope {
+	return Envelope{Version: ProtocolVersion, Type: t, Flags: flags}
+}
+
+// WithClientID returns env carrying the client id id.
+func (env Envelope) WithClientID(id uint64) Envelope {
+	env.Flags |= FlagClientID
+	env.ClientID = id
+	return env
+}
+
+// WithAck returns env acknowledging the replies up to request id ack.
+func (env Envelope) WithAck(ack uint32) Envelope {
+	env.Flags |= FlagAck
+	env.Ack = ack
+	return env
+}
+
+// Seal returns the datagram made of the envelope followed by body, with
+// BodyLength set from body and the CRC32C trailer appended if FlagChecksum
+// is set.
+func (env Envelope) Seal(body []byte) []byte {
+	env.BodyLength = uint32(len(body))
+
+	msg := make([]byte, 0, EnvelopeLen+clientIDLen+ackLen+len(body)+checksumLen)
+	msg = binary.BigEndian.AppendUint16(msg, Magic)
+	msg = append(msg, env.Version, byte(env.Type))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(env.Flags))
+	msg = binary.BigEndian.AppendUint32(msg, env.BodyLength)
+	if env.Flags&FlagClientID != 0 {
+		msg = binary.BigEndian.AppendUint64(msg, env.ClientID)
+	}
+	if env.Flags&FlagAck != 0 {
+		msg = binary.BigEndian.AppendUint32(msg, env.Ack)
+	}
+	msg = append(msg, body...)
+
+	if env.Flags&FlagChecksum != 0 {
+		msg = binary.BigEndian.AppendUint32(msg, crc32.Checksum(msg, castagnoli))
+	}
+
+	return msg
+}
+
+// Open validates the envelope at the start of data, verifies the CRC32C
+// trailer if the envelope has one, and returns the envelope with the body.
+// Clients and the server both read every message through Open, so corrupted
+// messages are rejected with ErrChecksum and counted in ChecksumFailures.
+func Open(data []byte) (Envelope, []byte, error) {
+	var env Envelope
+	if len(data) < EnvelopeLen {
+		return env, nil, fmt.Errorf("%w: need %d bytes for the envelope, have %d", ErrShortBuffer, EnvelopeLen, len(data))
+	}
+	if magic := binary.BigEndian.Uint16(data); magic != Magic {
+		return env, nil, fmt.Errorf("%w: %#04x", ErrBadMagic, magic)
+	}
+
+	env.Version = data[2]
+	env.Type = MessageType(data[3])
+	env.Flags = Flags(binary.BigEndian.Uint16(data[4:6]))
+	env.BodyLength = binary.BigEndian.Uint32(data[6:10])
+
+	// verify the trailer first so corruption anywhere in the message is
+	// reported as such rather than as whichever field it happened to hit
+	if env.Flags&FlagChecksum != 0 {
+		if len(data) < EnvelopeLen+checksumLen {
+			return env, nil, fmt.Errorf("%w: need %d bytes for the checksum, have %d", ErrShortBuffer, checksumLen, len(data)-EnvelopeLen)
+		}
+		signed := data[:len(data)-checksumLen]
+		want := binary.BigEndian.Uint32(data[len(signed):])
+		if got := crc32.Checksum(signed, castagnoli); got != want {
+			checksumFailures.Add(1)
+			return env, nil, fmt.Errorf("%w: computed %#08x, trailer says %#08x", ErrChecksum, got, want)
+		}
+	}
+
+	if env.Version != ProtocolVersion {
+		return env, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, env.Version)
+	}
+	if env.Type < MessageRequest || env.Type > MessageNotification {
+		return env, nil, fmt.Errorf("%w: %d", ErrUnknownMessageType, uint8(env.Type))
+	}
+	body := data[EnvelopeLen:]
+	if env.Flags&FlagChecksum != 0 {
+		body = body[:len(body)-checksumLen]
+	}
+	if env.Flags&FlagClientID != 0 {
+		if len(body) < clientIDLen {
+			return env, nil, fmt.Errorf("%w: need %d bytes for the client id, have %d", ErrShortBuffer, clientIDLen, len(body))
+		}
+		env.ClientID = binary.BigEndian.Uint64(body)
+		body = body[clientIDLen:]
+	}
+	if env.Flags&FlagAck != 0 {
+		if len(body) < ackLen {
+			return env, nil, fmt.Errorf("%w: need %d bytes for the acknowledgement, have %d", ErrShortBuffer, ackLen, len(body))
+		}
+		env.Ack = binary.BigEndian.Uint32(body)
+		body = body[ackLen:]
+	}
+	if uint64(len(body)) != uint64(env.BodyLength) {
+		return env, nil, fmt.Errorf("%w: envelope says %d, have %d", ErrBodyLength, env.BodyLength, len(body))
+	}
+
+	return env, body, nil
+}
+
+// BodyDecoder returns a Decoder for body in the representation env.Flags
+// selects.
+func (env Envelope) BodyDecoder(body []byte) (*Decoder, error) {
+	if env.Flags&FlagCDR != 0 {
+		return NewCDRDecoder(body)
+	}
+	return NewDecoder(body), nil
+}
+
+// BodyEncoder returns an Encoder for a body in the representation env.Flags
+// selects, big-endian in CDR mode.
+func (env Envelope) BodyEncoder() *Encoder {
+	if env.Flags&FlagCDR != 0 {
+		return NewCDREncoder(nil, binary.BigEndian)
+	}
+	return NewEncoder(nil)
+}
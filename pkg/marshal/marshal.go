@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"log"
 	"math"
+	"time"
 )
 
 func MarshalUint32(data uint32) []byte {
@@ -14,10 +15,6 @@ func MarshalUint32(data uint32) []byte {
 	return payload
 }
 
-func UnmarshalUint32(data []byte) uint32 {
-	return uint32(binary.BigEndian.Uint32(data[:4]))
-}
-
 func MarshalInt64(data int64) []byte {
 	payload := make([]byte, 8)
 	binary.BigEndian.PutUint64(payload, uint64(data))
@@ -25,10 +22,6 @@ func MarshalInt64(data int64) []byte {
 	return payload
 }
 
-func UnmarshalInt64(data []byte) int64 {
-	return int64(binary.BigEndian.Uint64(data))
-}
-
 func MarshalFloat64(data float64) []byte {
 	buf := new(bytes.Buffer)
 	err := binary.Write(buf, binary.BigEndian, data)
@@ -38,22 +31,12 @@ func MarshalFloat64(data float64) []byte {
 	return buf.Bytes()
 }
 
-func UnmarshalFloat64(data []byte) float64 {
-	return math.Float64frombits(binary.BigEndian.Uint64(data))
-}
-
 func MarshalString(data string) []byte {
 	payload := bytes.Join([][]byte{MarshalUint32(uint32(len(data))), []byte(data)}, []byte{})
 
 	return payload
 }
 
-func UnmarshalString(data []byte) string {
-	lenData := UnmarshalUint32(data[:4])
-
-	return string(data[4 : 4+lenData])
-}
-
 func MarshalUint32Array(data []uint32) []byte {
 	lenData := len(data)
 	payload := make([]byte, 4+lenData*4)
@@ -73,3 +56,50 @@ func MarshalBool(data bool) []byte {
 	}
 	return []byte{0}
 }
+
+func MarshalInt8(data int8) []byte {
+	return []byte{byte(data)}
+}
+
+func MarshalUint8(data uint8) []byte {
+	return []byte{data}
+}
+
+func MarshalInt16(data int16) []byte {
+	return MarshalUint16(uint16(data))
+}
+
+func MarshalUint16(data uint16) []byte {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, data)
+
+	return payload
+}
+
+func MarshalInt32(data int32) []byte {
+	return MarshalUint32(uint32(data))
+}
+
+func MarshalUint64(data uint64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, data)
+
+	return payload
+}
+
+func MarshalFloat32(data float32) []byte {
+	return MarshalUint32(math.Float32bits(data))
+}
+
+// MarshalOctets encodes an octet sequence: a uint32 length followed by the
+// raw bytes.
+func MarshalOctets(data []byte) []byte {
+	return bytes.Join([][]byte{MarshalUint32(uint32(len(data))), data}, []byte{})
+}
+
+// MarshalTime encodes t as an int64 count of nanoseconds since the Unix
+// epoch. The location is not preserved and decoded times are in UTC; the
+// representable range is roughly the years 1678 to 2262.
+func MarshalTime(data time.Time) []byte {
+	return MarshalInt64(data.UnixNano())
+}
@@ -0,0 +1,464 @@
+package marshal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Enum is implemented by named integer types used as enumerations. Marshal
+// encodes them as a uint32, as CDR does, and Unmarshal rejects values that
+// are not below EnumCount.
+type Enum interface {
+	EnumCount() uint32
+}
+
+var (
+	enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// Marshal encodes v using the same representation as the per-primitive
+// helpers: big-endian integers and floats, uint32 length-prefixed strings,
+// slices and maps, and single-byte bools. Structs are encoded field by field;
+// see structFields for how the `cdr` tag controls ordering.
+//
+// Beyond the primitives, fixed-size arrays are encoded without a count,
+// pointers are optional values preceded by a presence flag, map entries are
+// written in ascending order of their encoded keys, Enum types take four
+// bytes and time.Time is encoded as by MarshalTime (nanoseconds, UTC).
+func Marshal(v any) ([]byte, error) {
+	e := NewEncoder(nil)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// Unmarshal decodes data into the value pointed to by v. The whole of data
+// must be consumed.
+func Unmarshal(data []byte, v any) error {
+	d := NewDecoder(data)
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+
+	return d.Finish()
+}
+
+// MarshalCDR is like Marshal but produces an OMG-compatible CDR
+// encapsulation in the given byte order; see NewCDREncoder.
+func MarshalCDR(v any, order binary.ByteOrder) ([]byte, error) {
+	e := NewCDREncoder(nil, order)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// UnmarshalCDR is like Unmarshal for data produced by MarshalCDR or any
+// other CDR encapsulation, in either byte order.
+func UnmarshalCDR(data []byte, v any) error {
+	d, err := NewCDRDecoder(data)
+	if err != nil {
+		return err
+	}
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+
+	return d.Finish()
+}
+
+// Encode appends v to the payload as Marshal would, in e's mode.
+func (e *Encoder) Encode(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	return encodeValue(e, rv)
+}
+
+// Decode reads the next value into the value pointed to by v, as Unmarshal
+// would, in d's mode. Unlike Unmarshal it does not require the payload to
+// end afterwards.
+func (d *Decoder) Decode(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("marshal: Decode requires a non-nil pointer")
+	}
+
+	return decodeValue(d, rv.Elem())
+}
+
+func encodeValue(e *Encoder, v reflect.Value) error {
+	// a nil interface, as from Marshal(nil), has no type to encode
+	if !v.IsValid() {
+		return errors.New("marshal: cannot encode nil")
+	}
+	if v.Type() == timeType {
+		e.WriteTime(v.Interface().(time.Time))
+		return nil
+	}
+	if v.Type().Implements(enumType) && isInteger(v.Kind()) {
+		e.WriteEnum(uint32(integerBits(v)))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		e.WriteBool(v.Bool())
+	case reflect.Int8:
+		e.WriteInt8(int8(v.Int()))
+	case reflect.Int16:
+		e.WriteInt16(int16(v.Int()))
+	case reflect.Int32:
+		e.WriteInt32(int32(v.Int()))
+	case reflect.Int, reflect.Int64:
+		e.WriteInt64(v.Int())
+	case reflect.Uint8:
+		e.WriteUint8(uint8(v.Uint()))
+	case reflect.Uint16:
+		e.WriteUint16(uint16(v.Uint()))
+	case reflect.Uint32:
+		e.WriteUint32(uint32(v.Uint()))
+	case reflect.Uint, reflect.Uint64:
+		e.WriteUint64(v.Uint())
+	case reflect.Float32:
+		e.WriteFloat32(float32(v.Float()))
+	case reflect.Float64:
+		e.WriteFloat64(v.Float())
+	case reflect.String:
+		e.WriteString(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && !v.Type().Elem().Implements(enumType) {
+			e.WriteOctets(v.Bytes())
+			return nil
+		}
+		e.WriteUint32(uint32(v.Len()))
+		return encodeElements(e, v)
+	case reflect.Array:
+		return encodeElements(e, v)
+	case reflect.Map:
+		return encodeMap(e, v)
+	case reflect.Struct:
+		fields, err := structFields(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := encodeValue(e, v.Field(f.index)); err != nil {
+				return fmt.Errorf("%s.%s: %w", v.Type().Name(), f.name, err)
+			}
+		}
+	case reflect.Pointer:
+		e.WriteBool(!v.IsNil())
+		if !v.IsNil() {
+			return encodeValue(e, v.Elem())
+		}
+	default:
+		return fmt.Errorf("marshal: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func encodeElements(e *Encoder, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := encodeValue(e, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeMap writes the entries sorted by their unaligned encoded keys so that
+// equal maps always produce equal bytes.
+func encodeMap(e *Encoder, v reflect.Value) error {
+	type entry struct {
+		sortKey []byte
+		key     reflect.Value
+		value   reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key := &Encoder{order: e.order}
+		if err := encodeValue(key, iter.Key()); err != nil {
+			return err
+		}
+		entries = append(entries, entry{sortKey: key.Bytes(), key: iter.Key(), value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].sortKey, entries[j].sortKey) < 0 })
+
+	e.WriteUint32(uint32(len(entries)))
+	for _, en := range entries {
+		if err := encodeValue(e, en.key); err != nil {
+			return err
+		}
+		if err := encodeValue(e, en.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(d *Decoder, v reflect.Value) error {
+	if v.Type() == timeType {
+		t, err := d.ReadTime()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.Type().Implements(enumType) && isInteger(v.Kind()) {
+		n, err := d.ReadEnum(v.Interface().(Enum).EnumCount())
+		if err != nil {
+			return err
+		}
+		setInteger(v, uint64(n))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int8:
+		n, err := d.ReadInt8()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Int16:
+		n, err := d.ReadInt16()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Int32:
+		n, err := d.ReadInt32()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Int, reflect.Int64:
+		n, err := d.ReadInt64()
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8:
+		n, err := d.ReadUint8()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint16:
+		n, err := d.ReadUint16()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint32:
+		n, err := d.ReadUint32()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Uint, reflect.Uint64:
+		n, err := d.ReadUint64()
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32:
+		f, err := d.ReadFloat32()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(f))
+	case reflect.Float64:
+		f, err := d.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := d.ReadString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		n, err := d.length(1)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		if err := decodeElements(d, s); err != nil {
+			return err
+		}
+		v.Set(s)
+	case reflect.Array:
+		return decodeElements(d, v)
+	case reflect.Map:
+		return decodeMap(d, v)
+	case reflect.Struct:
+		fields, err := structFields(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := decodeValue(d, v.Field(f.index)); err != nil {
+				return fmt.Errorf("%s.%s: %w", v.Type().Name(), f.name, err)
+			}
+		}
+	case reflect.Pointer:
+		present, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+		if !present {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeValue(d, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		return fmt.Errorf("marshal: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func decodeElements(d *Decoder, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := decodeValue(d, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeMap(d *Decoder, v reflect.Value) error {
+	n, err := d.length(2)
+	if err != nil {
+		return err
+	}
+	m := reflect.MakeMapWithSize(v.Type(), n)
+	for i := 0; i < n; i++ {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := decodeValue(d, key); err != nil {
+			return err
+		}
+		if m.MapIndex(key).IsValid() {
+			return fmt.Errorf("%w: %v", ErrDuplicateKey, key)
+		}
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeValue(d, value); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, value)
+	}
+	v.Set(m)
+
+	return nil
+}
+
+func isInteger(k reflect.Kind) bool {
+	return (k >= reflect.Int && k <= reflect.Int64) || (k >= reflect.Uint && k <= reflect.Uint64)
+}
+
+func integerBits(v reflect.Value) uint64 {
+	if v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 {
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func setInteger(v reflect.Value, n uint64) {
+	if v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 {
+		v.SetInt(int64(n))
+		return
+	}
+	v.SetUint(n)
+}
+
+type field struct {
+	index int
+	name  string
+	order int
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the encodable fields of t in wire order. Unexported
+// fields and fields tagged `cdr:"-"` are skipped. Fields are encoded in
+// declaration order unless they carry an explicit position such as
+// `cdr:"2"`; once one field in a struct has a position, every encoded field
+// must have a distinct one.
+func structFields(t reflect.Type) ([]field, error) {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field), nil
+	}
+
+	fields := make([]field, 0, t.NumField())
+	ordered := 0
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := strings.TrimSpace(sf.Tag.Get("cdr"))
+		if tag == "-" {
+			continue
+		}
+		f := field{index: i, name: sf.Name, order: -1}
+		if tag != "" {
+			order, err := strconv.Atoi(tag)
+			if err != nil || order < 0 {
+				return nil, fmt.Errorf("marshal: invalid cdr tag %q on %s.%s", tag, t.Name(), sf.Name)
+			}
+			f.order = order
+			ordered++
+		}
+		fields = append(fields, f)
+	}
+
+	if ordered > 0 {
+		if ordered != len(fields) {
+			return nil, fmt.Errorf("marshal: %s mixes ordered and unordered cdr fields", t.Name())
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].order < fields[j].order })
+		for i := 1; i < len(fields); i++ {
+			if fields[i].order == fields[i-1].order {
+				return nil, fmt.Errorf("marshal: %s has duplicate cdr position %d", t.Name(), fields[i].order)
+			}
+		}
+	}
+
+	fieldCache.Store(t, fields)
+
+	return fields, nil
+}
@@ -0,0 +1,107 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cabin uint8
+
+const (
+	economy cabin = iota
+	business
+	cabinCount
+)
+
+func (cabin) EnumCount() uint32 { return uint32(cabinCount) }
+
+type booking struct {
+	Seats  []uint32          `cdr:"2"`
+	ID     uint32            `cdr:"0"`
+	Cabin  cabin             `cdr:"1"`
+	Note   *string           `cdr:"3"`
+	Meals  map[string]uint16 `cdr:"4"`
+	Until  time.Time         `cdr:"5"`
+	Secret string            `cdr:"-"`
+}
+
+// encodings are the representations every value must round-trip through.
+var encodings = []struct {
+	name      string
+	marshal   func(any) ([]byte, error)
+	unmarshal func([]byte, any) error
+}{
+	{"plain", Marshal, Unmarshal},
+	{"CDR big-endian", func(v any) ([]byte, error) { return MarshalCDR(v, binary.BigEndian) }, UnmarshalCDR},
+	{"CDR little-endian", func(v any) ([]byte, error) { return MarshalCDR(v, binary.LittleEndian) }, UnmarshalCDR},
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	note := "window"
+	for _, want := range []booking{
+		{ID: 1, Cabin: business, Seats: []uint32{3, 4}, Note: &note, Meals: map[string]uint16{"veg": 1, "kosher": 2}, Until: time.Unix(1700000000, 5).UTC()},
+		{ID: 2, Seats: []uint32{}, Meals: map[string]uint16{}, Until: time.Unix(0, 0).UTC()},
+	} {
+		for _, enc := range encodings {
+			data, err := enc.marshal(want)
+			if err != nil {
+				t.Fatalf("%s: %v", enc.name, err)
+			}
+			var got booking
+			if err := enc.unmarshal(data, &got); err != nil {
+				t.Fatalf("%s: %v", enc.name, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %+v, want %+v", enc.name, got, want)
+			}
+		}
+	}
+}
+
+func TestMarshalSkipsAndOrdersFields(t *testing.T) {
+	data, err := Marshal(booking{ID: 7, Cabin: business, Secret: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ID then Cabin come first whatever the declaration order
+	if got := data[:8]; !reflect.DeepEqual(got, []byte{0, 0, 0, 7, 0, 0, 0, 1}) {
+		t.Errorf("starts with % x, want ID then Cabin", got)
+	}
+	var got booking
+	if err := Unmarshal(data, &got); err != nil || got.Secret != "" {
+		t.Errorf("Secret = %q, %v; want it left out", got.Secret, err)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := Marshal(nil); err == nil {
+		t.Error("Marshal(nil) succeeded")
+	}
+	if _, err := Marshal(struct{ C chan int }{}); err == nil {
+		t.Error("Marshal of a channel succeeded")
+	}
+	if _, err := Marshal(struct {
+		A uint32 `cdr:"0"`
+		B uint32
+	}{}); err == nil {
+		t.Error("Marshal of mixed ordered and unordered fields succeeded")
+	}
+
+	data, _ := Marshal(uint32(cabinCount))
+	var c cabin
+	if err := Unmarshal(data, &c); !errors.Is(err, ErrInvalidEnum) {
+		t.Errorf("Unmarshal of enum %d: %v, want ErrInvalidEnum", cabinCount, err)
+	}
+	e := NewEncoder(nil)
+	e.WriteUint32(2)
+	for _, s := range []string{"a", "x", "a", "y"} {
+		e.WriteString(s)
+	}
+	var m map[string]string
+	if err := Unmarshal(e.Bytes(), &m); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Unmarshal of a repeated key: %v, want ErrDuplicateKey", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package ratelimit limits how fast each client may send requests, with a
+// token bucket per client. Operations can cost more than one token, so that a
+// client may search more often than it reserves.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Limiter holds a token bucket per client. Every bucket starts full with
+// burst tokens and refills at rate tokens per second; a request is allowed
+// if its client's bucket holds enough tokens for its operation.
+type Limiter struct {
+	rate  float64
+	burst float64
+	costs map[uint32]float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a Limiter refilling rate tokens per second up to burst. An
+// operation costs the tokens costs gives for its selector, or one.
+func New(rate, burst float64, costs map[uint32]float64) (*Limiter, error) {
+	// NaN fails every comparison and would pass the checks below, then stop
+	// the buckets from ever running out
+	if !finite(rate) || !finite(burst) || rate <= 0 || burst <= 0 {
+		return nil, fmt.Errorf("rate limit and burst must be positive, got %v and %v", rate, burst)
+	}
+	for selector, cost := range costs {
+		if !finite(cost) || cost < 0 || cost > burst {
+			return nil, fmt.Errorf("cost %v of selector %d must be between 0 and the burst %v", cost, selector, burst)
+		}
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     burst,
+		costs:     costs,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// HostKey returns the bucket key of a peer at addr that has not proved who
+// it is: the host of addr without its port, so that a client cannot get a
+// fresh bucket by claiming another id or opening another socket. An addr
+// without a port, such as a loopback client name, is its own key.
+func HostKey(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// Allow reports whether client may run the operation with selector now, and
+// takes its cost from the client's bucket if so.
+func (l *Limiter) Allow(client string, selector uint32) bool {
+	cost, ok := l.costs[selector]
+	if !ok {
+		cost = 1
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.updated = now
+
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+// sweep forgets the buckets that have refilled, which a new bucket would
+// match, at most once per time it takes to refill an empty one.
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
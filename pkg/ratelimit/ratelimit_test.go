@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewRejectsInvalidLimits(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, tt := range []struct {
+		name        string
+		rate, burst float64
+		cost        float64
+	}{
+		{"zero rate", 0, 1, 1},
+		{"negative burst", 1, -1, 1},
+		{"NaN rate", nan, 1, 1},
+		{"NaN burst", 1, nan, 1},
+		{"NaN cost", 1, 1, nan},
+		{"infinite rate", inf, 1, 1},
+		{"infinite burst", 1, inf, 1},
+		{"negative infinite cost", 1, 1, math.Inf(-1)},
+		{"cost over burst", 1, 1, 2},
+	} {
+		if _, err := New(tt.rate, tt.burst, map[uint32]float64{1: tt.cost}); err == nil {
+			t.Errorf("%s: New accepted rate %v, burst %v, cost %v", tt.name, tt.rate, tt.burst, tt.cost)
+		}
+	}
+}
+
+func TestAllowSpendsBurst(t *testing.T) {
+	l, err := New(0.001, 3, map[uint32]float64{2: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Allow("a", 2) || !l.Allow("a", 1) {
+		t.Fatal("requests within the burst were refused")
+	}
+	if l.Allow("a", 1) {
+		t.Error("request over the burst was allowed")
+	}
+	if !l.Allow("b", 1) {
+		t.Error("another client shares the bucket of a")
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	for addr, want := range map[string]string{
+		"192.0.2.1:4000":   "192.0.2.1",
+		"192.0.2.1:4001":   "192.0.2.1",
+		"[2001:db8::1]:53": "2001:db8::1",
+		"loopback-client":  "loopback-client",
+	} {
+		if got := HostKey(addr); got != want {
+			t.Errorf("HostKey(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package responsemanager
+
+import (
+	"context"
+	"errors"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// bigCache keeps replies off the Go heap in bigcache's byte shards, which
+// keeps garbage collection cheap with many entries. Entries expire in
+// bulk as bigcache cleans its shards.
+type bigCache struct {
+	cache *bigcache.BigCache
+}
+
+func newBigCache(cfg CacheConfig) (*bigCache, error) {
+	config := bigcache.DefaultConfig(cfg.TTL)
+	config.CleanWindow = cfg.TTL / 4
+	if cfg.MaxEntries > 0 {
+		config.MaxEntriesInWindow = cfg.MaxEntries
+	}
+	if cfg.MaxBytes > 0 {
+		config.HardMaxCacheSize = (cfg.MaxBytes + 1<<20 - 1) >> 20
+	}
+	config.Verbose = false
+
+	cache, err := bigcache.New(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return &bigCache{cache: cache}, nil
+}
+
+func (c *bigCache) Get(key string) ([]byte, error) {
+	reply, err := c.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, ErrNotFound
+	}
+	return reply, err
+}
+
+func (c *bigCache) Set(key string, reply []byte) error {
+	return c.cache.Set(key, reply)
+}
+
+func (c *bigCache) Delete(key string) {
+	c.cache.Delete(key)
+}
+
+func (c *bigCache) Len() int {
+	return c.cache.Len()
+}
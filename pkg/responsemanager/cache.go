@@ -0,0 +1,59 @@
+package responsemanager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned by ResponseCache.Get for a key it does not hold.
+var ErrNotFound = errors.New("reply not cached")
+
+// ResponseCache stores sealed replies under their hash keys. Implementations
+// are safe for concurrent use and may drop entries at any time once they are
+// older than their TTL or to stay within their limits.
+type ResponseCache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, reply []byte) error
+	Delete(key string)
+	Len() int
+}
+
+// CacheConfig chooses and sizes the ResponseCache of a ResponseManager.
+type CacheConfig struct {
+	// Kind is "bigcache", "lru" or "map".
+	Kind string
+	// TTL is how long a reply is kept to answer duplicates of its request.
+	TTL time.Duration
+	// MaxEntries caps the number of replies, zero for no cap. bigcache only
+	// uses it to size its shards and never evicts because of it.
+	MaxEntries int
+	// MaxBytes caps the total size of the replies, zero for no cap. bigcache
+	// rounds it up to whole megabytes.
+	MaxBytes int
+}
+
+// DefaultCacheConfig is the cache the server has always used: bigcache,
+// keeping replies for ReplyLifetime.
+var DefaultCacheConfig = CacheConfig{Kind: "bigcache", TTL: ReplyLifetime}
+
+// NewCache returns the cache described by cfg.
+func NewCache(cfg CacheConfig) (ResponseCache, error) {
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("cache TTL must be positive, got %s", cfg.TTL)
+	}
+	if cfg.MaxEntries < 0 || cfg.MaxBytes < 0 {
+		return nil, fmt.Errorf("cache limits must not be negative")
+	}
+
+	switch cfg.Kind {
+	case "bigcache":
+		return newBigCache(cfg)
+	case "lru":
+		return newLRUCache(cfg)
+	case "map":
+		return newMapCache(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown cache %q, want bigcache, lru or map", cfg.Kind)
+	}
+}
@@ -0,0 +1,174 @@
+package responsemanager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var kinds = []string{"bigcache", "lru", "map"}
+
+func newTestCache(t *testing.T, cfg CacheConfig) ResponseCache {
+	t.Helper()
+	cache, err := NewCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestCacheTTL(t *testing.T) {
+	for _, kind := range kinds {
+		kind := kind
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+			// bigcache counts time in whole seconds and expires entries in
+			// its cleanup pass, so it needs a longer TTL and a longer wait
+			ttl, wait := 50*time.Millisecond, 2*time.Second
+			if kind == "bigcache" {
+				ttl, wait = time.Second, 5*time.Second
+			}
+			cache := newTestCache(t, CacheConfig{Kind: kind, TTL: ttl})
+			if err := cache.Set("key", []byte("reply")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cache.Get("key"); err != nil {
+				t.Fatalf("Get right after Set: %v", err)
+			}
+
+			deadline := time.Now().Add(wait)
+			for {
+				_, err := cache.Get("key")
+				if errors.Is(err, ErrNotFound) {
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("reply still cached %s after its TTL of %s", wait, ttl)
+				}
+				time.Sleep(ttl / 4)
+			}
+		})
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	for _, kind := range kinds {
+		t.Run(kind, func(t *testing.T) {
+			if kind == "bigcache" {
+				t.Skip("bigcache only sizes its shards with MaxEntries and never evicts because of it")
+			}
+			cache := newTestCache(t, CacheConfig{Kind: kind, TTL: time.Minute, MaxEntries: 3})
+			for i := 0; i < 4; i++ {
+				if err := cache.Set(fmt.Sprint(i), []byte("reply")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := cache.Len(); n != 3 {
+				t.Errorf("Len() = %d, want 3", n)
+			}
+			if _, err := cache.Get("0"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("oldest reply not evicted: %v", err)
+			}
+			for i := 1; i < 4; i++ {
+				if _, err := cache.Get(fmt.Sprint(i)); err != nil {
+					t.Errorf("reply %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	t.Run("bigcache", func(t *testing.T) {
+		// bigcache rounds MaxBytes up to a megabyte and evicts per shard
+		const size, n = 256, 16384
+		cache := newTestCache(t, CacheConfig{Kind: "bigcache", TTL: time.Minute, MaxBytes: 1 << 20})
+		for i := 0; i < n; i++ {
+			if err := cache.Set(fmt.Sprint(i), make([]byte, size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if held := cache.Len() * size; held > 1<<20 {
+			t.Errorf("holds %d bytes of replies, want at most %d", held, 1<<20)
+		}
+	})
+	for _, kind := range []string{"lru", "map"} {
+		t.Run(kind, func(t *testing.T) {
+			cache := newTestCache(t, CacheConfig{Kind: kind, TTL: time.Minute, MaxBytes: 10})
+			for i := 0; i < 3; i++ {
+				if err := cache.Set(fmt.Sprint(i), []byte("four")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := cache.Len(); n != 2 {
+				t.Errorf("Len() = %d, want 2", n)
+			}
+			if _, err := cache.Get("0"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("oldest reply not evicted: %v", err)
+			}
+
+			// replacing a reply frees its bytes
+			if err := cache.Set("2", []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Set("3", []byte("four")); err != nil {
+				t.Fatal(err)
+			}
+			if n := cache.Len(); n != 3 {
+				t.Errorf("Len() = %d after replacing a reply, want 3", n)
+			}
+		})
+	}
+}
+
+// BenchmarkCache compares the caches under the reservation workload: every
+// client sends requests with increasing ids, retransmits one in ten and
+// acknowledges its replies every eight requests, as ReserveFlight traffic
+// does.
+func BenchmarkCache(b *testing.B) {
+	for _, kind := range kinds {
+		b.Run(kind, func(b *testing.B) {
+			cfg := DefaultCacheConfig
+			cfg.Kind = kind
+			rm, err := NewResponseManager(cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			reservations(b, rm, 1000, make([]byte, 32))
+		})
+	}
+}
+
+// reservations drives rm the way dispatch does for at-most-once requests,
+// from clients clients in parallel.
+func reservations(b *testing.B, rm *ResponseManager, clients int, reply []byte) {
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(next.Add(1)))
+		reqIds := make([]uint32, clients)
+		for pb.Next() {
+			c := rng.Intn(len(reqIds))
+			client := fmt.Sprintf("client-%016x", c)
+
+			reqId := reqIds[c]
+			if reqId == 0 || rng.Intn(10) != 0 {
+				reqIds[c]++
+				reqId = reqIds[c]
+			}
+			if cached, first := rm.Begin(client, reqId, Waiter{Addr: client}); cached == nil && first {
+				rm.Finish(client, reqId, reply)
+			}
+			if reqId%8 == 0 {
+				rm.Acknowledge(client, reqId-1)
+			}
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package responsemanager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// History is an append-only file of cached replies, so that a reply the
+// server sent before a crash or restart is still replayed to a retransmitted
+// request afterwards instead of executing it again. Each record is
+//
+//	hashKey [12]byte | expires int64 | length uint32 | reply | crc uint32
+//
+// in little endian, where expires is in Unix nanoseconds and crc is the
+// CRC32C of everything before it. A record with an empty reply is a
+// tombstone: it drops the reply recorded earlier under its hashKey, which the
+// client acknowledged or the server evicted. A record torn by a crash fails
+// its check and ends the history, as does one claiming a reply longer than
+// historyMaxReply.
+type History struct {
+	mu   sync.Mutex
+	path string
+	ttl  time.Duration
+	file *os.File
+	w    *bufio.Writer
+}
+
+const (
+	historyKeyLen    = 12
+	historyHeaderLen = historyKeyLen + 8 + 4
+	// historyMaxReply bounds the replies kept in the history, the largest
+	// frame the server accepts.
+	historyMaxReply = 1 << 20
+)
+
+var historyTable = crc32.MakeTable(crc32.Castagnoli)
+
+// OpenHistory opens the history at path, creating it if needed, and calls
+// load for every reply that has not expired yet. Expired and damaged records
+// are compacted away before it returns. Replies appended later expire after
+// ttl.
+func OpenHistory(path string, ttl time.Duration, load func(hashKey, reply []byte)) (*History, error) {
+	h := &History{path: path, ttl: ttl}
+
+	records, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		load(rec.hashKey, rec.reply)
+	}
+	if err := h.rewrite(records); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+type historyRecord struct {
+	hashKey []byte
+	expires int64
+	reply   []byte
+}
+
+// read returns the unexpired records of the history file that no tombstone
+// dropped, stopping at the first damaged one.
+func (h *History) read() ([]historyRecord, error) {
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	now := time.Now().UnixNano()
+	r := bufio.NewReader(f)
+	var records []historyRecord
+	latest := make(map[string]int) // index in records of the reply under each key
+	for {
+		header := make([]byte, historyHeaderLen)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err != io.EOF {
+				log.Printf("[HISTORY] Ignoring truncated record after %d replies", len(records))
+			}
+			break
+		}
+		length := binary.LittleEndian.Uint32(header[historyKeyLen+8:])
+		if length > historyMaxReply {
+			log.Printf("[HISTORY] Ignoring damaged record of %d bytes after %d replies", length, len(records))
+			break
+		}
+		rest := make([]byte, length+4)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			log.Printf("[HISTORY] Ignoring truncated record after %d replies", len(records))
+			break
+		}
+		reply := rest[:length]
+		crc := crc32.Update(crc32.Checksum(header, historyTable), historyTable, reply)
+		if crc != binary.LittleEndian.Uint32(rest[length:]) {
+			log.Printf("[HISTORY] Ignoring damaged record after %d replies", len(records))
+			break
+		}
+
+		hashKey := header[:historyKeyLen]
+		if i, ok := latest[string(hashKey)]; ok {
+			records[i].reply = nil
+			delete(latest, string(hashKey))
+		}
+		expires := int64(binary.LittleEndian.Uint64(header[historyKeyLen:]))
+		if len(reply) > 0 && expires > now {
+			latest[string(hashKey)] = len(records)
+			records = append(records, historyRecord{hashKey: hashKey, expires: expires, reply: reply})
+		}
+	}
+
+	live := records[:0]
+	for _, rec := range records {
+		if rec.reply != nil {
+			live = append(live, rec)
+		}
+	}
+	return live, nil
+}
+
+// rewrite replaces the history file with records and reopens it for
+// appending. The new file is renamed into place, and the rename synced, so a
+// crash leaves either the old history or the new one.
+func (h *History) rewrite(records []historyRecord) error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, rec := range records {
+		w.Write(encodeRecord(rec))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file = tmp
+	h.w = bufio.NewWriter(tmp)
+	return syncDir(filepath.Dir(h.path))
+}
+
+// syncDir makes the entries of dir durable, such as a file just renamed into
+// it; syncing the file itself does not.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func encodeRecord(rec historyRecord) []byte {
+	buf := make([]byte, 0, historyHeaderLen+len(rec.reply)+4)
+	buf = append(buf, rec.hashKey...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(rec.expires))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(rec.reply)))
+	buf = append(buf, rec.reply...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, historyTable))
+}
+
+// Append records reply under hashKey and syncs it to disk, so the reply is
+// durable before it is sent.
+func (h *History) Append(hashKey, reply []byte) error {
+	if len(reply) == 0 {
+		return errors.New("history cannot keep an empty reply")
+	}
+	if len(reply) > historyMaxReply {
+		return fmt.Errorf("history keeps replies of up to %d bytes, got %d", historyMaxReply, len(reply))
+	}
+	return h.write([]historyRecord{{hashKey: hashKey, expires: time.Now().Add(h.ttl).UnixNano(), reply: reply}}, true)
+}
+
+// Forget writes tombstones for the replies under hashKeys, so that they are
+// not loaded again. It does not sync: a tombstone lost in a crash only brings
+// back a reply that expires on its own.
+func (h *History) Forget(hashKeys ...[]byte) error {
+	records := make([]historyRecord, len(hashKeys))
+	for i, hashKey := range hashKeys {
+		records[i] = historyRecord{hashKey: hashKey, expires: time.Now().Add(h.ttl).UnixNano()}
+	}
+	return h.write(records, false)
+}
+
+func (h *History) write(records []historyRecord, sync bool) error {
+	for _, rec := range records {
+		if len(rec.hashKey) != historyKeyLen {
+			return fmt.Errorf("history key must be %d bytes, got %d", historyKeyLen, len(rec.hashKey))
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return os.ErrClosed
+	}
+	for _, rec := range records {
+		if _, err := h.w.Write(encodeRecord(rec)); err != nil {
+			return err
+		}
+	}
+	if err := h.w.Flush(); err != nil || !sync {
+		return err
+	}
+	return h.file.Sync()
+}
+
+// Compact drops the expired and forgotten replies from the history file.
+func (h *History) Compact() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+	if err := h.w.Flush(); err != nil {
+		return err
+	}
+	records, err := h.read()
+	if err != nil {
+		return err
+	}
+	return h.rewrite(records)
+}
+
+// CompactEvery runs Compact every interval until the history is closed.
+func (h *History) CompactEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.mu.Lock()
+		closed := h.file == nil
+		h.mu.Unlock()
+		if closed {
+			return
+		}
+		if err := h.Compact(); err != nil {
+			log.Printf("[HISTORY] Compaction failed: %v", err)
+		}
+	}
+}
+
+// Close flushes and closes the history file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+	err := h.w.Flush()
+	if cerr := h.file.Close(); err == nil {
+		err = cerr
+	}
+	h.file = nil
+	return err
+}
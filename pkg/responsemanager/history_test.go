@@ -0,0 +1,132 @@
+package responsemanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openHistory opens the history at path and returns the replies it loads.
+func openHistory(t *testing.T, path string) (*History, map[string][]byte) {
+	t.Helper()
+	loaded := make(map[string][]byte)
+	h, err := OpenHistory(path, time.Minute, func(hashKey, reply []byte) {
+		loaded[string(hashKey)] = reply
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, loaded
+}
+
+func historyKey(n byte) []byte {
+	return bytes.Repeat([]byte{n}, historyKeyLen)
+}
+
+func TestHistoryReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, _ := openHistory(t, path)
+	for n := byte(1); n <= 3; n++ {
+		if err := h.Append(historyKey(n), []byte{n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	_, loaded := openHistory(t, path)
+	if len(loaded) != 3 {
+		t.Fatalf("loaded %d replies, want 3", len(loaded))
+	}
+	for n := byte(1); n <= 3; n++ {
+		if reply := loaded[string(historyKey(n))]; !bytes.Equal(reply, []byte{n}) {
+			t.Errorf("reply %d: got %v", n, reply)
+		}
+	}
+}
+
+func TestHistoryOversizedRecordIsDamage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, _ := openHistory(t, path)
+	if err := h.Append(historyKey(1), []byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Append(historyKey(2), make([]byte, historyMaxReply+1)); err == nil {
+		t.Error("Append kept a reply longer than the history allows")
+	}
+	h.Close()
+
+	// a record whose length was damaged to 4GB must not be allocated
+	header := make([]byte, historyHeaderLen)
+	copy(header, historyKey(3))
+	binary.LittleEndian.PutUint64(header[historyKeyLen:], uint64(time.Now().Add(time.Minute).UnixNano()))
+	binary.LittleEndian.PutUint32(header[historyKeyLen+8:], 0xffffffff)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(header)
+	f.Close()
+
+	_, loaded := openHistory(t, path)
+	if len(loaded) != 1 || !bytes.Equal(loaded[string(historyKey(1))], []byte("reply")) {
+		t.Errorf("loaded %v, want only the reply before the damaged record", loaded)
+	}
+}
+
+func TestHistoryForget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, _ := openHistory(t, path)
+	for n := byte(1); n <= 3; n++ {
+		if err := h.Append(historyKey(n), []byte{n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Forget(historyKey(1), historyKey(3)); err != nil {
+		t.Fatal(err)
+	}
+	// a reply recorded again after its tombstone is kept
+	if err := h.Append(historyKey(3), []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	_, loaded := openHistory(t, path)
+	if len(loaded) != 2 || !bytes.Equal(loaded[string(historyKey(2))], []byte{2}) || !bytes.Equal(loaded[string(historyKey(3))], []byte("again")) {
+		t.Errorf("loaded %q, want replies 2 and 3", loaded)
+	}
+}
+
+// TestAcknowledgedRepliesStayForgotten checks that replies dropped from the
+// cache by an acknowledgement or by eviction are not loaded after a restart.
+func TestAcknowledgedRepliesStayForgotten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	persisted := func() *ResponseManager {
+		rm := newTestManager(t)
+		rm.MaxPerClient = 2
+		if err := rm.Persist(path); err != nil {
+			t.Fatal(err)
+		}
+		return rm
+	}
+
+	rm := persisted()
+	for reqId := uint32(1); reqId <= 4; reqId++ {
+		if err := rm.SetCachedResponse("client", reqId, []byte("reply")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the window holds 3 and 4; 1 and 2 were evicted
+	rm.Acknowledge("client", 3)
+	rm.Close()
+
+	rm = persisted()
+	for reqId := uint32(1); reqId <= 4; reqId++ {
+		if cached, want := rm.Cached("client", reqId), reqId == 4; cached != want {
+			t.Errorf("request #%d: cached %v after restart, want %v", reqId, cached, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package responsemanager
+
+import (
+	"log"
+)
+
+// Replier sends replies on the transport a request arrived on.
+// server.Replier implements it.
+type Replier interface {
+	Send(addr string, data []byte) error
+	MaxMessage() int
+}
+
+// Waiter is where a reply must be sent: the address a copy of the request
+// came from and the transport it came on, as duplicates may arrive on
+// another listener than the original.
+type Waiter struct {
+	Addr    string
+	Replier Replier
+}
+
+// inflight is a request whose handler is running, with the duplicates that
+// arrived meanwhile and are waiting for its reply.
+type inflight struct {
+	waiters []Waiter
+}
+
+// Begin claims request reqId from client before its handler runs. If the
+// reply is cached it is returned. If the request is already executing, waiter
+// is added to those its reply will be sent to and Begin returns false:
+// the duplicate must not be executed. Otherwise Begin returns true and the
+// caller must call Finish once the handler has run.
+func (responseManager *ResponseManager) Begin(client string, reqId uint32, waiter Waiter) ([]byte, bool) {
+	hashKey := responseManager.GetHashKey(reqId, client)
+
+	responseManager.mu.Lock()
+	defer responseManager.mu.Unlock()
+
+	// look for the request in flight before the cache: Finish caches the
+	// reply before it releases the request, so either check catches a
+	// duplicate racing with it
+	if call, ok := responseManager.inflight[string(hashKey)]; ok {
+		for _, w := range call.waiters {
+			if w == waiter {
+				return nil, false
+			}
+		}
+		call.waiters = append(call.waiters, waiter)
+		return nil, false
+	}
+	if cached, err := responseManager.GetCachedResponse(hashKey); err == nil {
+		return cached, false
+	}
+
+	responseManager.inflight[string(hashKey)] = &inflight{waiters: []Waiter{waiter}}
+	return nil, true
+}
+
+// Finish caches response as the reply to request reqId from client, claimed
+// with Begin, and releases the request. It returns every waiter the reply
+// must be sent to: the original request and the duplicates that arrived while
+// it was executing. A nil response releases the request without
+// caching anything, so that a retransmission executes it again.
+func (responseManager *ResponseManager) Finish(client string, reqId uint32, response []byte) []Waiter {
+	if response != nil {
+		if err := responseManager.SetCachedResponse(client, reqId, response); err != nil {
+			log.Printf("[CACHE] Cannot cache reply to request #%d from %s: %v", reqId, client, err)
+		}
+	}
+
+	hashKey := responseManager.GetHashKey(reqId, client)
+
+	responseManager.mu.Lock()
+	defer responseManager.mu.Unlock()
+
+	call, ok := responseManager.inflight[string(hashKey)]
+	if !ok {
+		return nil
+	}
+	delete(responseManager.inflight, string(hashKey))
+	return call.waiters
+}
@@ -0,0 +1,131 @@
+package responsemanager
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *ResponseManager {
+	t.Helper()
+	rm, err := NewResponseManager(CacheConfig{Kind: "map", TTL: ReplyLifetime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rm.Close() })
+	return rm
+}
+
+// handle runs a request the way the server does: the handler only runs for
+// the copy Begin lets through, and the reply goes to every waiter Finish
+// returns, or straight back if it was cached.
+func handle(rm *ResponseManager, client string, reqId uint32, waiter Waiter, handler func() []byte, replies chan<- Waiter) {
+	cached, first := rm.Begin(client, reqId, waiter)
+	if cached != nil {
+		replies <- waiter
+		return
+	}
+	if !first {
+		return
+	}
+	for _, w := range rm.Finish(client, reqId, handler()) {
+		replies <- w
+	}
+}
+
+func TestConcurrentDuplicatesRunOnce(t *testing.T) {
+	rm := newTestManager(t)
+
+	const copies = 50
+	var runs atomic.Int32
+	release := make(chan struct{})
+	handler := func() []byte {
+		runs.Add(1)
+		<-release // keep the request executing while the duplicates arrive
+		return []byte("reply")
+	}
+
+	replies := make(chan Waiter, copies)
+	var wg sync.WaitGroup
+	for i := 0; i < copies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			handle(rm, "client", 1, Waiter{Addr: fmt.Sprintf("addr-%d", i)}, handler, replies)
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+	close(replies)
+
+	if n := runs.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+	got := make(map[string]int)
+	for w := range replies {
+		got[w.Addr]++
+	}
+	for i := 0; i < copies; i++ {
+		if addr := fmt.Sprintf("addr-%d", i); got[addr] != 1 {
+			t.Errorf("%s got %d replies, want 1", addr, got[addr])
+		}
+	}
+}
+
+func TestDuplicateWaitsForReply(t *testing.T) {
+	rm := newTestManager(t)
+	first, second := Waiter{Addr: "first"}, Waiter{Addr: "second"}
+
+	if _, ok := rm.Begin("client", 1, first); !ok {
+		t.Fatal("first copy was not let through")
+	}
+	if cached, ok := rm.Begin("client", 1, second); cached != nil || ok {
+		t.Fatalf("duplicate of an executing request: got %q, %v", cached, ok)
+	}
+	// the same waiter is only recorded once
+	rm.Begin("client", 1, second)
+
+	to := rm.Finish("client", 1, []byte("reply"))
+	if len(to) != 2 || to[0] != first || to[1] != second {
+		t.Fatalf("Finish returned %v, want [first second]", to)
+	}
+
+	cached, ok := rm.Begin("client", 1, second)
+	if ok || !bytes.Equal(cached, []byte("reply")) {
+		t.Errorf("copy after Finish: got %q, %v; want the cached reply", cached, ok)
+	}
+}
+
+func TestFinishNilReleasesWaiters(t *testing.T) {
+	rm := newTestManager(t)
+	first, second := Waiter{Addr: "first"}, Waiter{Addr: "second"}
+
+	rm.Begin("client", 1, first)
+	rm.Begin("client", 1, second)
+	if to := rm.Finish("client", 1, nil); len(to) != 2 {
+		t.Fatalf("Finish(nil) returned %v, want both waiters", to)
+	}
+
+	// nothing was cached, so a retransmission executes again
+	if cached, ok := rm.Begin("client", 1, second); cached != nil || !ok {
+		t.Errorf("retransmission after Finish(nil): got %q, %v; want it let through", cached, ok)
+	}
+	if to := rm.Finish("client", 1, nil); len(to) != 1 || to[0] != second {
+		t.Errorf("Finish returned %v, want [second]", to)
+	}
+}
+
+func TestRequestsOfOtherClientsDoNotWait(t *testing.T) {
+	rm := newTestManager(t)
+	if _, ok := rm.Begin("a", 1, Waiter{Addr: "a"}); !ok {
+		t.Fatal("request of a was not let through")
+	}
+	if _, ok := rm.Begin("b", 1, Waiter{Addr: "b"}); !ok {
+		t.Error("request #1 of b waits for request #1 of a")
+	}
+	if _, ok := rm.Begin("a", 2, Waiter{Addr: "a"}); !ok {
+		t.Error("request #2 of a waits for request #1")
+	}
+}
@@ -0,0 +1,88 @@
+package responsemanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// lruCache evicts the least recently used reply once it holds MaxEntries
+// replies or MaxBytes bytes. golang-lru has no expiry, so entries carry
+// their own deadline and expired ones are dropped when looked up.
+type lruCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	size  int
+	cache *simplelru.LRU
+}
+
+type expiringReply struct {
+	reply   []byte
+	expires time.Time
+}
+
+// unboundedEntries stands in for no entry cap, which simplelru cannot express.
+const unboundedEntries = 1 << 30
+
+func newLRUCache(cfg CacheConfig) (*lruCache, error) {
+	c := &lruCache{ttl: cfg.TTL, max: cfg.MaxBytes}
+
+	entries := cfg.MaxEntries
+	if entries == 0 {
+		entries = unboundedEntries
+	}
+	cache, err := simplelru.NewLRU(entries, func(_, value interface{}) {
+		c.size -= len(value.(expiringReply).reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.cache = cache
+	return c, nil
+}
+
+func (c *lruCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.cache.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := value.(expiringReply)
+	if time.Now().After(entry.expires) {
+		c.cache.Remove(key)
+		return nil, ErrNotFound
+	}
+	return entry.reply, nil
+}
+
+func (c *lruCache) Set(key string, reply []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Add replaces an existing entry without calling the eviction callback
+	c.cache.Remove(key)
+	c.cache.Add(key, expiringReply{reply: reply, expires: time.Now().Add(c.ttl)})
+	c.size += len(reply)
+	for c.max > 0 && c.size > c.max {
+		c.cache.RemoveOldest()
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Remove(key)
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cache.Len()
+}
@@ -0,0 +1,95 @@
+package responsemanager
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// mapCache is a plain map behind a mutex. It is the simplest cache to reason
+// about, which makes it the reference when comparing the others. Once full,
+// it drops the oldest reply first.
+type mapCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+	size       int
+	entries    map[string]*list.Element
+	order      *list.List // of *mapEntry, oldest first
+}
+
+type mapEntry struct {
+	key     string
+	reply   []byte
+	expires time.Time
+}
+
+func newMapCache(cfg CacheConfig) *mapCache {
+	return &mapCache{
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   cfg.MaxBytes,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *mapCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := elem.Value.(*mapEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, ErrNotFound
+	}
+	return entry.reply, nil
+}
+
+func (c *mapCache) Set(key string, reply []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	now := time.Now()
+	c.entries[key] = c.order.PushBack(&mapEntry{key: key, reply: reply, expires: now.Add(c.ttl)})
+	c.size += len(reply)
+
+	// entries expire in insertion order, so the expired ones are at the front
+	for elem := c.order.Front(); elem != nil && now.After(elem.Value.(*mapEntry).expires); elem = c.order.Front() {
+		c.remove(elem)
+	}
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.size > c.maxBytes) {
+		c.remove(c.order.Front())
+	}
+	return nil
+}
+
+func (c *mapCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *mapCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *mapCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*mapEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.reply)
+}
@@ -1,29 +1,61 @@
 package responsemanager
 
 import (
-	"context"
 	"encoding/binary"
+	"log"
+	"sync"
 	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/cespare/xxhash/v2"
 )
 
+// ReplyLifetime is how long a reply is kept to answer duplicates of its
+// request unless the cache is configured otherwise.
+const ReplyLifetime = 5 * time.Minute
+
+// DefaultMaxPerClient is the default number of replies kept per client.
+const DefaultMaxPerClient = 64
+
 type ResponseManager struct {
-	manager bigcache.BigCache
+	cache   ResponseCache
+	ttl     time.Duration
+	history *History
+
+	// MaxPerClient caps the replies kept for one client that it has not
+	// acknowledged; past it the oldest is dropped. Zero means no cap.
+	MaxPerClient int
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	marks     map[string]mark
+	lastSweep time.Time
+	inflight  map[string]*inflight
 }
 
-func NewResponseManager() *ResponseManager {
-	responseManager, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(5*time.Minute))
+// NewResponseManager returns a ResponseManager keeping replies in the cache
+// described by cfg.
+func NewResponseManager(cfg CacheConfig) (*ResponseManager, error) {
+	cache, err := NewCache(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ResponseManager{
-		manager: *responseManager,
-	}
+		cache:        cache,
+		ttl:          cfg.TTL,
+		MaxPerClient: DefaultMaxPerClient,
+		windows:      make(map[string]*window),
+		marks:        make(map[string]mark),
+		lastSweep:    time.Now(),
+		inflight:     make(map[string]*inflight),
+	}, nil
 }
 
-func (responseManager *ResponseManager) GetHashKey(reqId uint32, user string) []byte {
+// GetHashKey returns the cache key of request reqId from the client with the
+// given id, which is its address unless it identified itself in the envelope.
+func (responseManager *ResponseManager) GetHashKey(reqId uint32, client string) []byte {
 	hasher := xxhash.New()
-	hasher.Write([]byte(user))
+	hasher.Write([]byte(client))
 	hash := hasher.Sum64()
 	hash ^= uint64(reqId)
 
@@ -34,7 +66,7 @@ func (responseManager *ResponseManager) GetHashKey(reqId uint32, user string) []
 }
 
 func (responseManager *ResponseManager) GetCachedResponse(hashKey []byte) ([]byte, error) {
-	cachedResponse, err := responseManager.manager.Get(string(hashKey))
+	cachedResponse, err := responseManager.cache.Get(string(hashKey))
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +74,57 @@ func (responseManager *ResponseManager) GetCachedResponse(hashKey []byte) ([]byt
 	return cachedResponse, nil
 }
 
-func (responseManager *ResponseManager) SetCachedResponse(hashKey []byte, response []byte) error {
-	err := responseManager.manager.Set(string(hashKey), response)
+// Cached reports whether the reply to request reqId from client is cached.
+func (responseManager *ResponseManager) Cached(client string, reqId uint32) bool {
+	_, err := responseManager.GetCachedResponse(responseManager.GetHashKey(reqId, client))
+	return err == nil
+}
+
+// Persist keeps the cached replies in the history file at path as well, so
+// they survive restarts. It loads the replies that have not expired into the
+// cache, so it must be called before the server accepts requests.
+func (responseManager *ResponseManager) Persist(path string) error {
+	loaded := 0
+	history, err := OpenHistory(path, responseManager.ttl, func(hashKey, reply []byte) {
+		if responseManager.cache.Set(string(hashKey), reply) == nil {
+			loaded++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[HISTORY] Loaded %d cached replies from %s", loaded, path)
+
+	responseManager.history = history
+	go history.CompactEvery(responseManager.ttl)
+	return nil
+}
+
+// Close closes the history file, if any.
+func (responseManager *ResponseManager) Close() error {
+	if responseManager.history == nil {
+		return nil
+	}
+	return responseManager.history.Close()
+}
+
+// SetCachedResponse caches response as the reply to request reqId from
+// client. With a history, the reply is on disk when it returns, so it can be
+// sent without risking that a crash makes the server execute the request
+// again.
+func (responseManager *ResponseManager) SetCachedResponse(client string, reqId uint32, response []byte) error {
+	hashKey := responseManager.GetHashKey(reqId, client)
+	if responseManager.history != nil {
+		if err := responseManager.history.Append(hashKey, response); err != nil {
+			return err
+		}
+	}
+
+	err := responseManager.cache.Set(string(hashKey), response)
 	if err != nil {
 		return err
 	}
 
+	responseManager.track(client, reqId)
 	return nil
 }
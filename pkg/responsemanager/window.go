@@ -0,0 +1,144 @@
+package responsemanager
+
+import (
+	"log"
+	"time"
+)
+
+// window lists the cached replies of one client that it has not acknowledged,
+// oldest first.
+type window struct {
+	replies []cachedReply
+}
+
+type cachedReply struct {
+	reqId  uint32
+	cached time.Time
+}
+
+// mark is the highest request id of a client whose reply was acknowledged or
+// evicted. A copy of such a request arriving late must not execute again,
+// since its reply is no longer there to answer it.
+type mark struct {
+	reqId uint32
+	at    time.Time
+}
+
+// track adds request reqId to the window of client, dropping the oldest
+// reply when the window is full.
+func (responseManager *ResponseManager) track(client string, reqId uint32) {
+	responseManager.mu.Lock()
+	defer responseManager.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(responseManager.lastSweep) > responseManager.ttl {
+		responseManager.sweep(now)
+	}
+
+	w, ok := responseManager.windows[client]
+	if !ok {
+		w = &window{}
+		responseManager.windows[client] = w
+	}
+	w.replies = append(w.replies, cachedReply{reqId: reqId, cached: now})
+
+	if max := responseManager.MaxPerClient; max > 0 && len(w.replies) > max {
+		evicted := w.replies[:len(w.replies)-max]
+		responseManager.forget(client, evicted)
+		for _, reply := range evicted {
+			responseManager.raiseMark(client, reply.reqId, now)
+		}
+		log.Printf("[CACHE] %s has %d unacknowledged replies, dropped the oldest %d", client, len(w.replies), len(evicted))
+		w.replies = append(w.replies[:0], w.replies[len(evicted):]...)
+	}
+}
+
+// Acknowledge drops the cached replies to every request of client up to and
+// including request id ack, which the client has received and so will not
+// retransmit. Clients number their requests in increasing order. It returns
+// the number of replies dropped.
+func (responseManager *ResponseManager) Acknowledge(client string, ack uint32) int {
+	responseManager.mu.Lock()
+	defer responseManager.mu.Unlock()
+
+	responseManager.raiseMark(client, ack, time.Now())
+	w, ok := responseManager.windows[client]
+	if !ok {
+		return 0
+	}
+
+	var kept, dropped []cachedReply
+	for _, reply := range w.replies {
+		if reply.reqId <= ack {
+			dropped = append(dropped, reply)
+			continue
+		}
+		kept = append(kept, reply)
+	}
+	responseManager.forget(client, dropped)
+	w.replies = kept
+	if len(w.replies) == 0 {
+		delete(responseManager.windows, client)
+	}
+
+	return len(dropped)
+}
+
+// forget drops replies of client from the cache and the history, so that a
+// restart does not load them again.
+func (responseManager *ResponseManager) forget(client string, replies []cachedReply) {
+	if len(replies) == 0 {
+		return
+	}
+	hashKeys := make([][]byte, len(replies))
+	for i, reply := range replies {
+		hashKeys[i] = responseManager.GetHashKey(reply.reqId, client)
+		responseManager.cache.Delete(string(hashKeys[i]))
+	}
+	if responseManager.history != nil {
+		if err := responseManager.history.Forget(hashKeys...); err != nil {
+			log.Printf("[HISTORY] Cannot forget %d replies of %s: %v", len(hashKeys), client, err)
+		}
+	}
+}
+
+// Forgotten reports whether request reqId of client is at or below the
+// highest request id whose reply client acknowledged or the cache evicted.
+// Such a request was executed already, so a late copy of it must be refused
+// rather than executed again.
+func (responseManager *ResponseManager) Forgotten(client string, reqId uint32) bool {
+	responseManager.mu.Lock()
+	defer responseManager.mu.Unlock()
+
+	m, ok := responseManager.marks[client]
+	return ok && reqId <= m.reqId
+}
+
+func (responseManager *ResponseManager) raiseMark(client string, reqId uint32, now time.Time) {
+	if m, ok := responseManager.marks[client]; !ok || reqId > m.reqId {
+		responseManager.marks[client] = mark{reqId: reqId, at: now}
+	}
+}
+
+// sweep forgets the replies that have expired from the cache on their own,
+// and with them the windows of clients that went away. Marks are kept as
+// long as replies, after which a duplicate executes again as it would once
+// its reply expired.
+func (responseManager *ResponseManager) sweep(now time.Time) {
+	for client, m := range responseManager.marks {
+		if now.Sub(m.at) > responseManager.ttl {
+			delete(responseManager.marks, client)
+		}
+	}
+	for client, w := range responseManager.windows {
+		i := 0
+		for i < len(w.replies) && now.Sub(w.replies[i].cached) > responseManager.ttl {
+			i++
+		}
+		w.replies = w.replies[i:]
+		if len(w.replies) == 0 {
+			delete(responseManager.windows, client)
+		}
+	}
+	responseManager.lastSweep = now
+}
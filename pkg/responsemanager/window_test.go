@@ -0,0 +1,38 @@
+package responsemanager
+
+import "testing"
+
+func TestForgottenAfterAcknowledge(t *testing.T) {
+	rm := newTestManager(t)
+	for reqId := uint32(1); reqId <= 3; reqId++ {
+		if err := rm.SetCachedResponse("client", reqId, []byte("reply")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := rm.Acknowledge("client", 2); n != 2 {
+		t.Errorf("Acknowledge dropped %d replies, want 2", n)
+	}
+	for reqId, want := range map[uint32]bool{1: true, 2: true, 3: false, 4: false} {
+		if got := rm.Forgotten("client", reqId); got != want {
+			t.Errorf("Forgotten(#%d) = %v, want %v", reqId, got, want)
+		}
+	}
+	if rm.Forgotten("other", 1) {
+		t.Error("requests of another client are forgotten")
+	}
+}
+
+func TestForgottenAfterEviction(t *testing.T) {
+	rm := newTestManager(t)
+	rm.MaxPerClient = 2
+	for reqId := uint32(1); reqId <= 4; reqId++ {
+		if err := rm.SetCachedResponse("client", reqId, []byte("reply")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for reqId, want := range map[uint32]bool{1: true, 2: true, 3: false, 4: false} {
+		if got := rm.Forgotten("client", reqId); got != want {
+			t.Errorf("Forgotten(#%d) = %v, want %v", reqId, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package secure
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"sync"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+// DefaultReplayWindow is how far apart the clocks of clients and the server
+// may drift, and how long the nonces of accepted requests are remembered.
+const DefaultReplayWindow = 2 * time.Minute
+
+// Guard opens the sealed requests of the clients in a Keyring and rejects
+// those that are forged, altered or replayed. A request is a replay if its
+// nonce was already accepted within the window; one sealed further than the
+// window from now is rejected outright, so nonces need only be remembered
+// that long. A client retransmitting a request must therefore seal it again
+// rather than resend the same datagram.
+type Guard struct {
+	keys   *Keyring
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[seenKey]time.Time // when each nonce may be forgotten
+	lastSweep time.Time
+}
+
+type seenKey struct {
+	client uint64
+	nonce  [nonceLen]byte
+}
+
+func NewGuard(keys *Keyring, window time.Duration) *Guard {
+	return &Guard{
+		keys:      keys,
+		window:    window,
+		seen:      make(map[seenKey]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// OpenRequest returns the plain body of a request, as returned with env by
+// marshal.Open, and the key of its client, which its reply is sealed with.
+func (g *Guard) OpenRequest(env marshal.Envelope, body []byte) ([]byte, cipher.AEAD, error) {
+	if env.Flags&marshal.FlagSealed == 0 {
+		return nil, nil, ErrNotSealed
+	}
+	if env.Flags&marshal.FlagClientID == 0 {
+		return nil, nil, fmt.Errorf("%w: request has no client id", ErrUnknownClient)
+	}
+	aead, ok := g.keys.Key(env.ClientID)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %016x", ErrUnknownClient, env.ClientID)
+	}
+	plain, sealedAt, err := Open(aead, env, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if skew := now.Sub(sealedAt); skew > g.window || skew < -g.window {
+		return nil, nil, fmt.Errorf("%w: sealed %s ago", ErrStale, skew.Round(time.Millisecond))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(now)
+	key := seenKey{client: env.ClientID, nonce: nonce(body)}
+	if _, ok := g.seen[key]; ok {
+		return nil, nil, ErrReplay
+	}
+	// the request is stale once sealedAt+window has passed, so its nonce
+	// need not be remembered after that
+	g.seen[key] = sealedAt.Add(g.window)
+	return plain, aead, nil
+}
+
+// sweep forgets the nonces of requests that are now stale anyway, at most
+// once per window.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.window {
+		return
+	}
+	g.lastSweep = now
+	for key, forget := range g.seen {
+		if now.After(forget) {
+			delete(g.seen, key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package secure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func newTestGuard(t *testing.T, window time.Duration) *Guard {
+	t.Helper()
+	ring, err := ParseKeyring(strings.NewReader(fmt.Sprintf("0000000000001234 %s\n", testKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(ring, window)
+}
+
+// openRequest opens message through g as the server does.
+func openRequest(g *Guard, message []byte) ([]byte, error) {
+	env, body, err := marshal.Open(message)
+	if err != nil {
+		return nil, err
+	}
+	plain, _, err := g.OpenRequest(env, body)
+	return plain, err
+}
+
+func TestGuardOpenRequest(t *testing.T) {
+	g := newTestGuard(t, DefaultReplayWindow)
+	aead, _ := g.keys.Key(0x1234)
+	request := marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(0x1234)
+	other := newTestAEAD(t)
+
+	for _, tt := range []struct {
+		name    string
+		message []byte
+		want    error
+	}{
+		{"valid", Seal(aead, request, []byte("body")), nil},
+		{"not sealed", request.Seal([]byte("body")), ErrNotSealed},
+		{"no client id", Seal(aead, marshal.NewEnvelope(marshal.MessageRequest, 0), []byte("body")), ErrUnknownClient},
+		{"unknown client", Seal(aead, request.WithClientID(0x9999), []byte("body")), ErrUnknownClient},
+		{"wrong key", Seal(other, request, []byte("body")), ErrAuthentication},
+		{"sealed too long ago", sealAt(aead, request, []byte("body"), time.Now().Add(-DefaultReplayWindow-time.Second)), ErrStale},
+		{"sealed in the future", sealAt(aead, request, []byte("body"), time.Now().Add(DefaultReplayWindow+time.Second)), ErrStale},
+		{"within the window", sealAt(aead, request, []byte("body"), time.Now().Add(-DefaultReplayWindow/2)), nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := openRequest(g, tt.message)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !bytes.Equal(plain, []byte("body")) {
+				t.Errorf("opened %q", plain)
+			}
+		})
+	}
+}
+
+func TestGuardRejectsReplay(t *testing.T) {
+	g := newTestGuard(t, DefaultReplayWindow)
+	aead, _ := g.keys.Key(0x1234)
+	request := marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(0x1234)
+
+	message := Seal(aead, request, []byte("reserve"))
+	if _, err := openRequest(g, message); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openRequest(g, message); !errors.Is(err, ErrReplay) {
+		t.Errorf("replayed request: got %v, want %v", err, ErrReplay)
+	}
+	// a retransmission sealed again has a fresh nonce
+	if _, err := openRequest(g, Seal(aead, request, []byte("reserve"))); err != nil {
+		t.Errorf("request sealed again: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package secure
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+// Keyring holds the key of every client allowed to talk to the server.
+type Keyring struct {
+	keys map[uint64]cipher.AEAD
+}
+
+// LoadKeyring reads a key file; see ParseKeyring for its format.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ring, err := ParseKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ring, nil
+}
+
+// ParseKeyring reads one client per line as
+//
+//	clientId key
+//
+// with clientId the 16 hex digits of the id the client puts in its envelopes
+// and key 32, 48 or 64 hex digits. Blank lines and lines starting with # are
+// skipped.
+func ParseKeyring(r io.Reader) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[uint64]cipher.AEAD)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want a client id and a key, got %d fields", line, len(fields))
+		}
+		id, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: client id: %w", line, err)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key: %w", line, err)
+		}
+		aead, err := NewAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := ring.keys[id]; ok {
+			return nil, fmt.Errorf("line %d: client %016x listed twice", line, id)
+		}
+		ring.keys[id] = aead
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Key returns the key of the client with id.
+func (ring *Keyring) Key(id uint64) (cipher.AEAD, bool) {
+	aead, ok := ring.keys[id]
+	return aead, ok
+}
+
+// Len returns the number of clients with a key.
+func (ring *Keyring) Len() int {
+	return len(ring.keys)
+}
+
+// Open opens a message sealed under one of the keys: the key of its client
+// id if it has one, or else each key in turn, since replies and
+// notifications carry no client id.
+func (ring *Keyring) Open(env marshal.Envelope, body []byte) ([]byte, time.Time, error) {
+	if env.Flags&marshal.FlagClientID != 0 {
+		aead, ok := ring.Key(env.ClientID)
+		if !ok {
+			return nil, time.Time{}, fmt.Errorf("%w %016x", ErrUnknownClient, env.ClientID)
+		}
+		return Open(aead, env, body)
+	}
+	for _, aead := range ring.keys {
+		if plain, sealedAt, err := Open(aead, env, body); err == nil {
+			return plain, sealedAt, nil
+		}
+	}
+	return nil, time.Time{}, ErrAuthentication
+}
@@ -0,0 +1,96 @@
+package secure
+
+import (
+	"crypto/cipher"
+	"errors"
+	"strings"
+	"testing"
+
+	"goflysys/pkg/marshal"
+)
+
+func TestParseKeyring(t *testing.T) {
+	ring, err := ParseKeyring(strings.NewReader(`
+# clients of the booking desk
+0000000000000001 000102030405060708090a0b0c0d0e0f
+  00000000000000ff   000102030405060708090a0b0c0d0e0f1011121314151617
+
+abcdef0123456789 ` + testKey + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", ring.Len())
+	}
+	for _, id := range []uint64{1, 0xff, 0xabcdef0123456789} {
+		if _, ok := ring.Key(id); !ok {
+			t.Errorf("no key for %016x", id)
+		}
+	}
+	if _, ok := ring.Key(2); ok {
+		t.Error("key for a client not in the file")
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, text, want string
+	}{
+		{"one field", "0000000000000001\n", "line 1: want a client id and a key, got 1 fields"},
+		{"three fields", "1 " + testKey + " extra\n", "line 1: want a client id and a key, got 3 fields"},
+		{"bad client id", "# ids\nxyz " + testKey + "\n", "line 2: client id"},
+		{"client id too long", "10000000000000000 " + testKey + "\n", "line 1: client id"},
+		{"bad key hex", "1 zz0102030405060708090a0b0c0d0e0f\n", "line 1: key"},
+		{"odd key hex", "1 0001020\n", "line 1: key"},
+		{"bad key length", "1 0001020304\n", "line 1: crypto/aes: invalid key size"},
+		{"listed twice", "1 " + testKey + "\n\n0001 " + testKey + "\n", "line 3: client 0000000000000001 listed twice"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyring(strings.NewReader(tt.text))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error starting with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringOpen(t *testing.T) {
+	ring, err := ParseKeyring(strings.NewReader("1 " + testKey + "\n2 000102030405060708090a0b0c0d0e0f\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := ring.Key(2)
+
+	// replies carry no client id, so every key is tried
+	reply := Seal(second, marshal.NewEnvelope(marshal.MessageReply, 0), []byte("reply"))
+	env, body, err := marshal.Open(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, _, err := ring.Open(env, body); err != nil || string(plain) != "reply" {
+		t.Errorf("reply: opened %q, %v", plain, err)
+	}
+
+	other := newTestAEAD(t)
+	for _, tt := range []struct {
+		name string
+		aead cipher.AEAD
+		env  marshal.Envelope
+		want error
+	}{
+		{"under another client's key", second, marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(1), ErrAuthentication},
+		{"unknown client", second, marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(3), ErrUnknownClient},
+		{"no key fits", other, marshal.NewEnvelope(marshal.MessageReply, 0), ErrAuthentication},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env, body, err := marshal.Open(Seal(tt.aead, tt.env, []byte("body")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := ring.Open(env, body); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
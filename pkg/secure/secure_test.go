@@ -0,0 +1,149 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"goflysys/pkg/marshal"
+)
+
+func newTestAEAD(t *testing.T) cipher.AEAD {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+// sealAt seals like Seal, with the timestamp at instead of now.
+func sealAt(aead cipher.AEAD, env marshal.Envelope, body []byte, at time.Time) []byte {
+	env.Flags |= marshal.FlagSealed
+	sealed := make([]byte, headerLen)
+	binary.BigEndian.PutUint64(sealed, uint64(at.UnixNano()))
+	rand.Read(sealed[timestampLen:])
+	sealed = aead.Seal(sealed, sealed[timestampLen:headerLen], body, additionalData(env, sealed[:timestampLen]))
+	return env.Seal(sealed)
+}
+
+// open opens message as the receiving side does.
+func open(aead cipher.AEAD, message []byte) ([]byte, time.Time, error) {
+	env, body, err := marshal.Open(message)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return Open(aead, env, body)
+}
+
+func TestSealOpen(t *testing.T) {
+	aead := newTestAEAD(t)
+	for _, tt := range []struct {
+		name string
+		env  marshal.Envelope
+		body []byte
+	}{
+		{"request", marshal.NewEnvelope(marshal.MessageRequest, marshal.FlagChecksum).WithClientID(0x1234), []byte("request body")},
+		{"request with ack", marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(0x1234).WithAck(7), []byte("request body")},
+		{"reply", marshal.NewEnvelope(marshal.MessageReply, marshal.FlagCDR), []byte("reply body")},
+		{"empty body", marshal.NewEnvelope(marshal.MessageNotification, 0), nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			message := Seal(aead, tt.env, tt.body)
+			if bytes.Contains(message, tt.body) && len(tt.body) > 0 {
+				t.Error("sealed message contains the plain body")
+			}
+			env, _, err := marshal.Open(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Flags&marshal.FlagSealed == 0 {
+				t.Error("FlagSealed not set")
+			}
+
+			plain, sealedAt, err := open(aead, message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, tt.body) {
+				t.Errorf("opened %q, want %q", plain, tt.body)
+			}
+			if sealedAt.Before(before) || sealedAt.After(time.Now()) {
+				t.Errorf("sealed at %s, not between %s and now", sealedAt, before)
+			}
+		})
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	aead := newTestAEAD(t)
+	env := marshal.NewEnvelope(marshal.MessageRequest, 0).WithClientID(0x1234).WithAck(7)
+	sealed, body, err := marshal.Open(Seal(aead, env, []byte("reserve 2 seats")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		tamper func(env *marshal.Envelope, body []byte) []byte
+	}{
+		{"ciphertext", func(_ *marshal.Envelope, body []byte) []byte { body[len(body)-20] ^= 1; return body }},
+		{"tag", func(_ *marshal.Envelope, body []byte) []byte { body[len(body)-1] ^= 1; return body }},
+		{"nonce", func(_ *marshal.Envelope, body []byte) []byte { body[timestampLen] ^= 1; return body }},
+		{"timestamp", func(_ *marshal.Envelope, body []byte) []byte { body[timestampLen-1] ^= 1; return body }},
+		{"client id", func(env *marshal.Envelope, body []byte) []byte { env.ClientID++; return body }},
+		{"ack", func(env *marshal.Envelope, body []byte) []byte { env.Ack++; return body }},
+		{"type", func(env *marshal.Envelope, body []byte) []byte { env.Type = marshal.MessageReply; return body }},
+		{"version", func(env *marshal.Envelope, body []byte) []byte { env.Version++; return body }},
+		{"codec flag", func(env *marshal.Envelope, body []byte) []byte { env.Flags |= marshal.CodecJSON; return body }},
+		{"checksum flag", func(env *marshal.Envelope, body []byte) []byte { env.Flags |= marshal.FlagChecksum; return body }},
+		{"ack flag", func(env *marshal.Envelope, body []byte) []byte { env.Flags &^= marshal.FlagAck; return body }},
+		{"truncated", func(_ *marshal.Envelope, body []byte) []byte { return body[:headerLen+aead.Overhead()-1] }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env := sealed
+			body := tt.tamper(&env, append([]byte(nil), body...))
+			if _, _, err := Open(aead, env, body); !errors.Is(err, ErrAuthentication) {
+				t.Errorf("got %v, want %v", err, ErrAuthentication)
+			}
+		})
+	}
+
+	env.Flags &^= marshal.FlagSealed
+	if _, _, err := Open(aead, env, body); !errors.Is(err, ErrNotSealed) {
+		t.Errorf("without FlagSealed: got %v, want %v", err, ErrNotSealed)
+	}
+}
+
+func TestOpenRejectsOtherKey(t *testing.T) {
+	message := Seal(newTestAEAD(t), marshal.NewEnvelope(marshal.MessageReply, 0), []byte("reply"))
+	if _, _, err := open(newTestAEAD(t), message); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("got %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestSenderSeals(t *testing.T) {
+	aead := newTestAEAD(t)
+	var sent []byte
+	s := Sender{Next: sendFunc(func(addr string, data []byte) error { sent = data; return nil }), AEAD: aead}
+	plain := marshal.NewEnvelope(marshal.MessageNotification, 0).Seal([]byte("seat 3 freed"))
+	if err := s.Send("addr", plain); err != nil {
+		t.Fatal(err)
+	}
+	if body, _, err := open(aead, sent); err != nil || string(body) != "seat 3 freed" {
+		t.Errorf("opened %q, %v", body, err)
+	}
+}
+
+type sendFunc func(addr string, data []byte) error
+
+func (f sendFunc) Send(addr string, data []byte) error { return f(addr, data) }
@@ -1,15 +1,45 @@
+// Package shutdown stops the server cleanly when it is asked to terminate.
 package shutdown
 
 import (
+	"context"
+	"errors"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-func Gracefully() {
-	quit := make(chan os.Signal, 1)
-	defer close(quit)
-
+// Gracefully blocks until the process receives SIGINT or SIGTERM, or an error
+// arrives on failed, then calls stop. It returns that error together with
+// stop's, so the process exits with a failure if either is set. The context
+// passed to stop expires after timeout, or as soon as a second signal
+// arrives, and stop should give up waiting for work still in progress once
+// it is done.
+func Gracefully(timeout time.Duration, failed <-chan error, stop func(ctx context.Context) error) error {
+	quit := make(chan os.Signal, 2)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	defer signal.Stop(quit)
+
+	var cause error
+	select {
+	case sig := <-quit:
+		log.Printf("Received %s, shutting down within %s", sig, timeout)
+	case cause = <-failed:
+		log.Printf("%v, shutting down within %s", cause, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-quit:
+			log.Printf("Received %s again, shutting down now", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return errors.Join(cause, stop(ctx))
 }